@@ -0,0 +1,75 @@
+/*
+Copyright 2016 Ville Koskela
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package gosteno
+
+import (
+	"strings"
+)
+
+// Abbreviator of logger names to a target length as with the logger name abbreviation of logback. The package path
+// segments (separated by slashes) and the segments of the last path element (separated by periods) are abbreviated to
+// their first character from left to right until the name fits within the target length; the last segment is never
+// abbreviated. The segments of an abbreviated name are all separated by periods. For example,
+// github.com/acme/platform/billing/invoices.worker abbreviated to 24 characters is g.a.p.b.invoices.worker and to 30
+// characters is g.a.p.billing.invoices.worker. Abbreviations are cached by name.
+type loggerNameAbbreviator struct {
+	targetLength int
+	abbreviations cacheMap
+}
+
+func newLoggerNameAbbreviator(targetLength int) *loggerNameAbbreviator {
+	return &loggerNameAbbreviator{targetLength: targetLength}
+}
+
+func (lna *loggerNameAbbreviator) abbreviate(name string) string {
+	if lna == nil || len(name) <= lna.targetLength {
+		return name
+	}
+	if abbreviation, ok := lna.abbreviations.load(name); ok {
+		return abbreviation.(string)
+	}
+	var abbreviation string = abbreviateLoggerName(name, lna.targetLength)
+	lna.abbreviations.store(name, abbreviation)
+	return abbreviation
+}
+
+func abbreviateLoggerName(name string, targetLength int) string {
+	// The offsets of the separators following each segment other than the last
+	var separators []int
+	var lastSlash int = strings.LastIndexByte(name, '/')
+	for i := 0; i < len(name); i++ {
+		if name[i] == '/' || name[i] == '.' && i > lastSlash {
+			separators = append(separators, i)
+		}
+	}
+	var abbreviation []byte = make([]byte, 0, targetLength)
+	var length int = len(name)
+	var start int = 0
+	for _, separator := range separators {
+		if length <= targetLength {
+			break
+		}
+		if separator > start {
+			// Abbreviate the segment to its first character
+			abbreviation = append(abbreviation, name[start])
+			length -= separator - start - 1
+		}
+		abbreviation = append(abbreviation, '.')
+		start = separator + 1
+	}
+	abbreviation = append(abbreviation, strings.Replace(name[start:], "/", ".", -1)...)
+	return string(abbreviation)
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2016 Ville Koskela
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package gosteno
+
+import (
+	"strings"
+	"testing"
+	"github.com/Sirupsen/logrus"
+)
+
+func TestAbbreviateLoggerName(t *testing.T) {
+	t.Parallel()
+	var tests []struct {
+		name string
+		targetLength int
+		expected string
+	} = []struct {
+		name string
+		targetLength int
+		expected string
+	}{
+		{"github.com/acme/platform/billing/invoices.worker", 100, "github.com/acme/platform/billing/invoices.worker"},
+		{"github.com/acme/platform/billing/invoices.worker", 48, "github.com/acme/platform/billing/invoices.worker"},
+		{"github.com/acme/platform/billing/invoices.worker", 45, "g.acme.platform.billing.invoices.worker"},
+		{"github.com/acme/platform/billing/invoices.worker", 30, "g.a.p.billing.invoices.worker"},
+		{"github.com/acme/platform/billing/invoices.worker", 24, "g.a.p.b.invoices.worker"},
+		{"github.com/acme/platform/billing/invoices.worker", 16, "g.a.p.b.i.worker"},
+		{"github.com/acme/platform/billing/invoices.worker", 1, "g.a.p.b.i.worker"},
+		{"com.acme.billing.InvoiceWorker", 20, "c.a.b.InvoiceWorker"},
+		{"com.acme.billing.InvoiceWorker", 25, "c.a.billing.InvoiceWorker"},
+		{"http.server", 5, "h.server"},
+		{"InvoiceWorker", 5, "InvoiceWorker"},
+		{"/acme//billing", 5, ".a..billing"},
+		{"", 5, ""},
+	}
+	for _, test := range tests {
+		if actual := newLoggerNameAbbreviator(test.targetLength).abbreviate(test.name); actual != test.expected {
+			t.Errorf("Incorrect abbreviation of %s to %d; expected %s but was %s", test.name, test.targetLength, test.expected, actual)
+		}
+	}
+}
+
+func TestLoggerNameAbbreviatorCache(t *testing.T) {
+	t.Parallel()
+	var abbreviator *loggerNameAbbreviator = newLoggerNameAbbreviator(10)
+	abbreviator.abbreviate("com.acme.billing.InvoiceWorker")
+	if cached, ok := abbreviator.abbreviations.load("com.acme.billing.InvoiceWorker"); !ok || cached != "c.a.b.InvoiceWorker" {
+		t.Errorf("Expected abbreviation to be cached %v", cached)
+	}
+	abbreviator.abbreviate("short")
+	if _, ok := abbreviator.abbreviations.load("short"); ok {
+		t.Errorf("Unexpected cache of name within target length")
+	}
+}
+
+func TestFormatterLoggerNameLength(t *testing.T) {
+	t.Parallel()
+	var formatter *Formatter = NewFormatter()
+	if v := formatter.LoggerNameLength(); v != 0 {
+		t.Errorf("Incorrect default logger name length %d", v)
+	}
+	formatter.SetInjectContextLogger(true)
+	formatter.SetLoggerNameLength(24)
+	if v := formatter.LoggerNameLength(); v != 24 {
+		t.Errorf("Incorrect logger name length %d", v)
+	}
+	logger, buffer := HelperTestGetLogger("github.com/acme/platform/billing/invoices.worker", logrus.DebugLevel, formatter)
+	logger.InfoBuilder().SetMessage("TestFormatterLoggerNameLength").Log()
+	if !strings.Contains(buffer.String(), `"logger":"g.a.p.b.invoices.worker"`) {
+		t.Errorf("Expected abbreviated logger name in %s", buffer.String())
+	}
+
+	formatter.SetStrictContext(true)
+	buffer.Reset()
+	logger.InfoBuilder().SetMessage("TestFormatterLoggerNameLength").Log()
+	if !strings.Contains(buffer.String(), `"context":{"logger":"g.a.p.b.invoices.worker"}`) {
+		t.Errorf("Expected abbreviated relocated logger name in %s", buffer.String())
+	}
+
+	formatter.SetStrictContext(false)
+	formatter.SetLoggerNameLength(0)
+	buffer.Reset()
+	logger.InfoBuilder().SetMessage("TestFormatterLoggerNameLength").Log()
+	if !strings.Contains(buffer.String(), `"logger":"github.com/acme/platform/billing/invoices.worker"`) {
+		t.Errorf("Expected unabbreviated logger name in %s", buffer.String())
+	}
+}
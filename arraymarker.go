@@ -0,0 +1,113 @@
+/*
+Copyright 2016 Ville Koskela
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package gosteno
+
+import (
+	"strconv"
+	"github.com/Sirupsen/logrus"
+)
+
+const (
+	EVENT_DATA_DATA_KEYS_KEY string = "dataKeys"
+	EVENT_DATA_DATA_VALUES_KEY string = "dataValues"
+	EVENT_DATA_CONTEXT_KEYS_KEY string = "contextKeys"
+	EVENT_DATA_CONTEXT_VALUES_KEY string = "contextValues"
+)
+
+var (
+	_ Marker = (*ArrayMarker)(nil)
+)
+
+// Array marker implementation; data and context are supplied as parallel arrays of keys and values. Keys without a
+// value have a null value and values without a key are keyed by their index (e.g. "_3").
+type ArrayMarker struct { }
+
+// Encode.
+func (sam *ArrayMarker) Encode(
+		logger *logrus.Logger,
+		event string,
+		loggerName string,
+		dataKeys []string,
+		dataValues []interface{},
+		contextKeys []string,
+		contextValues []interface{},
+		err error) *logrus.Entry {
+
+	var entry *logrus.Entry = logrus.NewEntry(logger).WithFields(logrus.Fields{
+		MarkerKey: sam,
+		EVENT_DATA_EVENT_KEY: event,
+		EVENT_DATA_LOGGER_KEY: loggerName,
+		EVENT_DATA_DATA_KEYS_KEY: dataKeys,
+		EVENT_DATA_DATA_VALUES_KEY: dataValues,
+		EVENT_DATA_CONTEXT_KEYS_KEY: contextKeys,
+		EVENT_DATA_CONTEXT_VALUES_KEY: contextValues,
+		EVENT_DATA_ERROR_KEY: err,})
+	if err != nil {
+		entry.Data[StackKey] = captureStack(1)
+	}
+	return entry
+}
+
+// Parse event name from event.
+func (sam *ArrayMarker) ParseEvent(e *logrus.Entry) string {
+	v, _ := e.Data[EVENT_DATA_EVENT_KEY].(string)
+	return v
+}
+
+// Parse logger name from event.
+func (sam *ArrayMarker) ParseLoggerName(e *logrus.Entry) string {
+	v, _ := e.Data[EVENT_DATA_LOGGER_KEY].(string)
+	return v
+}
+
+// Parse data from event.
+func (sam *ArrayMarker) ParseData(e *logrus.Entry) map[string]interface{} {
+	return zipKeysAndValues(e.Data[EVENT_DATA_DATA_KEYS_KEY], e.Data[EVENT_DATA_DATA_VALUES_KEY])
+}
+
+// Parse context from event.
+func (sam *ArrayMarker) ParseContext(e *logrus.Entry) map[string]interface{} {
+	return zipKeysAndValues(e.Data[EVENT_DATA_CONTEXT_KEYS_KEY], e.Data[EVENT_DATA_CONTEXT_VALUES_KEY])
+}
+
+// Parse error from event.
+func (sam *ArrayMarker) ParseError(e *logrus.Entry) error {
+	v, _ := e.Data[EVENT_DATA_ERROR_KEY].(error)
+	return v
+}
+
+// Combine parallel arrays of keys and values into a map; keys without a value have a nil value and values without a key
+// are keyed by their index prefixed by an underscore. Later duplicate keys take precedence.
+func zipKeysAndValues(k interface{}, v interface{}) map[string]interface{} {
+	keys, _ := k.([]string)
+	values, _ := v.([]interface{})
+	var size int = len(keys)
+	if len(values) > size {
+		size = len(values)
+	}
+	var result map[string]interface{} = make(map[string]interface{}, size)
+	for i, key := range keys {
+		if i < len(values) {
+			result[key] = values[i]
+		} else {
+			result[key] = nil
+		}
+	}
+	for i := len(keys); i < len(values); i++ {
+		result["_" + strconv.Itoa(i)] = values[i]
+	}
+	return result
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2016 Ville Koskela
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package gosteno
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"github.com/Sirupsen/logrus"
+)
+
+var (
+	am *ArrayMarker = new(ArrayMarker)
+)
+
+func TestArrayMarkerEncode(t *testing.T) {
+	t.Parallel()
+	var expectedError error = errors.New("this is an error")
+	var e *logrus.Entry = am.Encode(
+		logger,
+		"my_event",
+		"my_logger",
+		[]string{"foo", "one"},
+		[]interface{}{"bar", 1},
+		[]string{"bar"},
+		[]interface{}{"foo"},
+		expectedError)
+	if v := am.ParseEvent(e); v != "my_event" {
+		t.Errorf("Encode failed to encode event %s", v)
+	}
+	if v := am.ParseLoggerName(e); v != "my_logger" {
+		t.Errorf("Encode failed to encode logger %s", v)
+	}
+	if v := am.ParseData(e); !reflect.DeepEqual(v, map[string]interface{}{"foo": "bar", "one": 1}) {
+		t.Errorf("Encode failed to encode data %v", v)
+	}
+	if v := am.ParseContext(e); !reflect.DeepEqual(v, map[string]interface{}{"bar": "foo"}) {
+		t.Errorf("Encode failed to encode context %v", v)
+	}
+	if v := am.ParseError(e); v != expectedError {
+		t.Errorf("Encode failed to encode error %v", v)
+	}
+	if _, ok := e.Data[StackKey]; !ok {
+		t.Errorf("Encode failed to capture stack")
+	}
+}
+
+func TestArrayMarkerParseMismatchedLengths(t *testing.T) {
+	t.Parallel()
+	var e *logrus.Entry = am.Encode(
+		logger,
+		"",
+		"",
+		[]string{"a", "b", "c"},
+		[]interface{}{1},
+		[]string{"a"},
+		[]interface{}{1, 2, 3},
+		nil)
+	if v := am.ParseData(e); !reflect.DeepEqual(v, map[string]interface{}{"a": 1, "b": nil, "c": nil}) {
+		t.Errorf("ParseData failed for missing values %v", v)
+	}
+	if v := am.ParseContext(e); !reflect.DeepEqual(v, map[string]interface{}{"a": 1, "_1": 2, "_2": 3}) {
+		t.Errorf("ParseContext failed for missing keys %v", v)
+	}
+}
+
+func TestArrayMarkerParseEmpty(t *testing.T) {
+	t.Parallel()
+	if v := am.ParseEvent(emptyEntry); v != "" {
+		t.Errorf("ParseEvent failed; expected empty instead actual '%s'", v)
+	}
+	if v := am.ParseLoggerName(emptyEntry); v != "" {
+		t.Errorf("ParseLoggerName failed; expected empty instead actual '%s'", v)
+	}
+	if v := am.ParseData(emptyEntry); len(v) != 0 {
+		t.Errorf("ParseData failed; expected empty instead actual '%v'", v)
+	}
+	if v := am.ParseContext(emptyEntry); len(v) != 0 {
+		t.Errorf("ParseContext failed; expected empty instead actual '%v'", v)
+	}
+	if v := am.ParseError(emptyEntry); v != nil {
+		t.Errorf("ParseError failed; expected nil instead actual '%v'", v)
+	}
+}
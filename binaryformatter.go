@@ -0,0 +1,178 @@
+/*
+Copyright 2016 Ville Koskela
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package gosteno
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"github.com/Sirupsen/logrus"
+)
+
+const (
+	// The size of the big endian length prefixing each event.
+	frameHeaderSize = 4
+
+	// The maximum size of an event accepted by the Decoder.
+	maxFrameSize = 64 * 1024 * 1024
+
+	// The maximum nesting of objects and arrays accepted by the Decoder.
+	maxDecodeDepth = 10000
+
+	// The size reserved for object and array headers while writing; the header is compacted once the number of
+	// elements is known.
+	containerHeaderReserve = 5
+)
+
+var (
+	errTruncated = errors.New("gosteno: truncated value")
+)
+
+// Binary encoding of the json data model.
+type binaryCodec interface {
+	appendNil(dst []byte) []byte
+	appendBool(dst []byte, v bool) []byte
+	appendInt(dst []byte, v int64) []byte
+	appendUint(dst []byte, v uint64) []byte
+	appendFloat(dst []byte, v float64) []byte
+	appendFloat32(dst []byte, v float32) []byte
+
+	// Append the header of a string of n bytes.
+	appendStringHeader(dst []byte, n int) []byte
+
+	appendArrayHeader(dst []byte, n int) []byte
+	appendMapHeader(dst []byte, n int) []byte
+
+	// Append the json encoding of the first value in src returning the remainder of src.
+	appendJson(dst []byte, src []byte, depth int) ([]byte, []byte, error)
+}
+
+// Decoder converts events produced by MsgpackFormatter or CBORFormatter back to Steno json (e.g. for validation).
+type Decoder struct {
+	reader io.Reader
+	codec binaryCodec
+	buffer []byte
+}
+
+func NewMsgpackDecoder(r io.Reader) *Decoder {
+	return &Decoder{reader: r, codec: msgpackCodec{}}
+}
+
+func NewCBORDecoder(r io.Reader) *Decoder {
+	return &Decoder{reader: r, codec: cborCodec{}}
+}
+
+// Decode the next event and return it as a Steno json document; returns io.EOF when no events remain.
+func (d *Decoder) Decode() ([]byte, error) {
+	var header [frameHeaderSize]byte
+	if _, err := io.ReadFull(d.reader, header[:]); err != nil {
+		return nil, err
+	}
+	var size uint32 = binary.BigEndian.Uint32(header[:])
+	if size > maxFrameSize {
+		return nil, fmt.Errorf("gosteno: event size %d exceeds maximum %d", size, maxFrameSize)
+	}
+	if cap(d.buffer) < int(size) {
+		d.buffer = make([]byte, size)
+	}
+	var frame []byte = d.buffer[:size]
+	if _, err := io.ReadFull(d.reader, frame); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	result, rest, err := d.codec.appendJson(nil, frame, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("gosteno: %d unexpected bytes following event", len(rest))
+	}
+	return result, nil
+}
+
+// Format the event as a length prefixed binary encoding of the Steno document; an event exceeding the maximum size
+// accepted by the Decoder is not formatted.
+func formatBinary(sf *Formatter, codec binaryCodec, e *logrus.Entry) ([]byte, error) {
+	var buffer *[]byte = getBuffer()
+	var w *eventWriter = getEventWriter(eventFormatBinary, codec, append(*buffer, 0, 0, 0, 0))
+	sf.writeEvent(w, e)
+	var b []byte = putEventWriter(w)
+	if size := len(b) - frameHeaderSize; size > maxFrameSize {
+		*buffer = b
+		putBuffer(buffer)
+		return nil, fmt.Errorf("gosteno: event size %d exceeds maximum %d", size, maxFrameSize)
+	}
+	binary.BigEndian.PutUint32(b, uint32(len(b) - frameHeaderSize))
+	return completeFormat(e, buffer, b), nil
+}
+
+// Replace the header reserved for the object or array with the compact header once its number of elements is known.
+func compactContainerHeader(dst []byte, codec binaryCodec, frame writerFrame) []byte {
+	var reserve [containerHeaderReserve]byte
+	var header []byte
+	if frame.array {
+		header = codec.appendArrayHeader(reserve[:0], frame.count)
+	} else {
+		header = codec.appendMapHeader(reserve[:0], frame.count)
+	}
+	var size int = copy(dst[frame.start + len(header):], dst[frame.start + containerHeaderReserve:])
+	copy(dst[frame.start:], header)
+	return dst[:frame.start + len(header) + size]
+}
+
+// Append the big-endian encoding of the integer.
+func appendUint16(dst []byte, v uint16) []byte {
+	return append(dst, byte(v >> 8), byte(v))
+}
+
+// Append the big-endian encoding of the integer.
+func appendUint32(dst []byte, v uint32) []byte {
+	return append(dst, byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v))
+}
+
+// Append the big-endian encoding of the integer.
+func appendUint64(dst []byte, v uint64) []byte {
+	return appendUint32(appendUint32(dst, uint32(v >> 32)), uint32(v))
+}
+
+// Split the first n bytes from src.
+func splitBytes(src []byte, n uint64) ([]byte, []byte, error) {
+	if uint64(len(src)) < n {
+		return nil, nil, errTruncated
+	}
+	return src[:n], src[n:], nil
+}
+
+// Append the json encoding of binary data; consistent with encoding/json this is a base64 string.
+func appendJsonBytes(dst []byte, v []byte) []byte {
+	dst = append(dst, '"')
+	dst = append(dst, base64.StdEncoding.EncodeToString(v)...)
+	return append(dst, '"')
+}
+
+// Append the json encoding of a decoded float; non-finite values cannot be represented.
+func appendDecodedFloat(dst []byte, v float64, bits int) ([]byte, error) {
+	var start int = len(dst)
+	dst, err := appendJsonFloat(dst, v, bits)
+	if err != nil {
+		return dst[:start], err
+	}
+	return dst, nil
+}
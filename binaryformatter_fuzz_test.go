@@ -0,0 +1,60 @@
+//go:build go1.18
+// +build go1.18
+
+/*
+Copyright 2016 Ville Koskela
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package gosteno
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"github.com/Sirupsen/logrus"
+)
+
+func FuzzMsgpackDecoder(f *testing.F) {
+	helperFuzzDecoder(f, NewMsgpackFormatter().Formatter, &MsgpackFormatter{}, NewMsgpackDecoder)
+}
+
+func FuzzCBORDecoder(f *testing.F) {
+	helperFuzzDecoder(f, NewCBORFormatter().Formatter, &CBORFormatter{}, NewCBORDecoder)
+}
+
+func helperFuzzDecoder(f *testing.F, formatter *Formatter, binaryFormatter logrus.Formatter, newDecoder func(io.Reader) *Decoder) {
+	formatter.SetIdGenerator(NewNoIdGenerator())
+	switch binaryFormatter := binaryFormatter.(type) {
+	case *MsgpackFormatter:
+		binaryFormatter.Formatter = formatter
+	case *CBORFormatter:
+		binaryFormatter.Formatter = formatter
+	}
+	for _, entry := range helperTestBinaryEntries() {
+		result, _ := binaryFormatter.Format(entry)
+		f.Add(result)
+	}
+	f.Fuzz(func(t *testing.T, stream []byte) {
+		var decoder *Decoder = newDecoder(bytes.NewReader(stream))
+		for {
+			document, err := decoder.Decode()
+			if err != nil {
+				return
+			}
+			if !isValidJson(document) {
+				t.Errorf("Decoded event is not valid json %s", string(document))
+			}
+		}
+	})
+}
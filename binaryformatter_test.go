@@ -0,0 +1,189 @@
+/*
+Copyright 2016 Ville Koskela
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package gosteno
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"github.com/Sirupsen/logrus"
+)
+
+func TestMsgpackFormatterRoundTrip(t *testing.T) {
+	t.Parallel()
+	var formatter *MsgpackFormatter = NewMsgpackFormatter()
+	helperTestBinaryRoundTrip(t, formatter, formatter.Formatter, NewMsgpackDecoder)
+}
+
+func TestCBORFormatterRoundTrip(t *testing.T) {
+	t.Parallel()
+	var formatter *CBORFormatter = NewCBORFormatter()
+	helperTestBinaryRoundTrip(t, formatter, formatter.Formatter, NewCBORDecoder)
+}
+
+func TestMsgpackDecoderErrors(t *testing.T) {
+	t.Parallel()
+	helperTestDecoderErrors(t, NewMsgpackDecoder, []byte{0xc1})
+}
+
+func TestCBORDecoderErrors(t *testing.T) {
+	t.Parallel()
+	helperTestDecoderErrors(t, NewCBORDecoder, []byte{0x1c})
+}
+
+func TestCBORDecoderIndefinite(t *testing.T) {
+	t.Parallel()
+	var event []byte = []byte{
+		0xbf,										// indefinite map
+		0x61, 'a', 0x9f, 0x01, 0x20, 0xff,			// "a": indefinite array [1, -1]
+		0x61, 'b', 0xf9, 0x3e, 0x00,				// "b": half float 1.5
+		0x61, 'c', 0xc1, 0x1a, 0x56, 0x87, 0x3b, 0x15,	// "c": tagged epoch time 1451703061
+		0x61, 'd', 0x43, 0x01, 0x02, 0x03,			// "d": bytes
+		0xff,
+	}
+	var frame []byte = appendUint32(nil, uint32(len(event)))
+	document, err := NewCBORDecoder(bytes.NewReader(append(frame, event...))).Decode()
+	if err != nil {
+		t.Fatalf("Unexpected failure decoding cbor %v", err)
+	}
+	if v := string(document); v != `{"a":[1,-1],"b":1.5,"c":1451703061,"d":"AQID"}` {
+		t.Errorf("Incorrect decoding of cbor %s", v)
+	}
+}
+
+func TestBinaryFormatterSize(t *testing.T) {
+	t.Parallel()
+	var formatter *Formatter = NewFormatter()
+	formatter.SetIdGenerator(NewNoIdGenerator())
+	var msgpackFormatter *MsgpackFormatter = &MsgpackFormatter{Formatter: formatter}
+	var cborFormatter *CBORFormatter = &CBORFormatter{Formatter: formatter}
+	for _, entry := range helperTestBinaryEntries() {
+		jsonResult, _ := formatter.Format(entry)
+		msgpackResult, _ := msgpackFormatter.Format(entry)
+		cborResult, _ := cborFormatter.Format(entry)
+		if len(msgpackResult) >= len(jsonResult) || len(cborResult) >= len(jsonResult) {
+			t.Errorf("Binary encoding is not smaller; json %d, msgpack %d and cbor %d bytes", len(jsonResult), len(msgpackResult), len(cborResult))
+		}
+	}
+}
+
+func TestBinaryFormatterOversized(t *testing.T) {
+	t.Parallel()
+	var entry *logrus.Entry = logrus.NewEntry(logrus.New())
+	entry.Message = strings.Repeat("x", maxFrameSize)
+	for _, formatter := range []logrus.Formatter{NewMsgpackFormatter(), NewCBORFormatter()} {
+		if result, err := formatter.Format(entry); result != nil || err == nil {
+			t.Errorf("Expected oversized event to fail without a frame but was %d bytes and %v", len(result), err)
+		}
+	}
+}
+
+func helperTestBinaryEntries() []*logrus.Entry {
+	var logger *logrus.Logger = logrus.New()
+	var longString string = strings.Repeat("TestBinaryFormatter", 4000)
+	var parts []interface{} = make([]interface{}, 0, 20)
+	for i := 0; i < 20; i++ {
+		parts = append(parts, createWidget(fmt.Sprintf("part-%d", i)))
+	}
+	var entries []*logrus.Entry = []*logrus.Entry{
+		MarkerMaps.Encode(logger, "my_event", "TestBinaryFormatter",
+			map[string]interface{}{
+				"integers": []interface{}{0, 1, -1, -32, -33, 127, 128, -128, -129, 255, 256, 65535, 65536, -32768,
+					-32769, math.MaxInt32, math.MinInt32, math.MaxInt64, math.MinInt64, uint64(math.MaxUint64)},
+				"floats": []float64{0.5, -2.25, 1e21, 1e-7, math.MaxFloat64},
+				"singles": []float32{0.1, -3.5, math.MaxFloat32},
+				"strings": []string{"", "short", strings.Repeat("x", 31), strings.Repeat("y", 32), strings.Repeat("z", 300), longString},
+				"parts": parts,
+				"nested": map[string]interface{}{"empty": map[string]interface{}{}, "none": nil, "yes": true, "no": false},
+			},
+			map[string]interface{}{},
+			&testWrappedError{testDomainError{"request failed: timeout\nrefused"},
+				&testJoinedError{testDomainError{"timeout\nrefused"}, []error{errors.New("timeout"), errors.New("refused")}}}),
+		logrus.NewEntry(logger).WithField("key", "value").WithError(errors.New("failure")),
+	}
+	entries[0].Message = "TestBinaryFormatter"
+	entries[0].Level = logrus.ErrorLevel
+	entries[1].Message = "TestBinaryFormatter\n\"quoted\" <html>  "
+	entries[1].Level = logrus.WarnLevel
+	return entries
+}
+
+func helperTestBinaryRoundTrip(t *testing.T, formatter logrus.Formatter, jsonFormatter *Formatter, newDecoder func(io.Reader) *Decoder) {
+	jsonFormatter.SetIdGenerator(NewNoIdGenerator())
+	var stream *bytes.Buffer = new(bytes.Buffer)
+	var expected [][]byte
+	for _, entry := range helperTestBinaryEntries() {
+		result, err := formatter.Format(entry)
+		if err != nil {
+			t.Fatalf("Unexpected failure formatting event %v", err)
+		}
+		stream.Write(result)
+		jsonResult, _ := jsonFormatter.Format(entry)
+		expected = append(expected, bytes.TrimSuffix(jsonResult, []byte("\n")))
+	}
+	var decoder *Decoder = newDecoder(stream)
+	for _, expectedDocument := range expected {
+		document, err := decoder.Decode()
+		if err != nil {
+			t.Fatalf("Unexpected failure decoding event %v", err)
+		}
+		if !helperTestJsonEqual(expectedDocument, document) {
+			t.Errorf("Decoded event does not match; expected is %s but actual was %s", string(expectedDocument), string(document))
+		}
+		HelperTestValidate(t, document)
+	}
+	if _, err := decoder.Decode(); err != io.EOF {
+		t.Errorf("Expected end of events but was %v", err)
+	}
+}
+
+// Whether the json documents are equal ignoring the order of object members.
+func helperTestJsonEqual(expected []byte, actual []byte) bool {
+	var expectedValue, actualValue interface{}
+	var decoder *json.Decoder = json.NewDecoder(bytes.NewReader(expected))
+	decoder.UseNumber()
+	if err := decoder.Decode(&expectedValue); err != nil {
+		return false
+	}
+	decoder = json.NewDecoder(bytes.NewReader(actual))
+	decoder.UseNumber()
+	if err := decoder.Decode(&actualValue); err != nil {
+		return false
+	}
+	return reflect.DeepEqual(expectedValue, actualValue)
+}
+
+func helperTestDecoderErrors(t *testing.T, newDecoder func(io.Reader) *Decoder, invalidEvent []byte) {
+	var cases map[string][]byte = map[string][]byte{
+		"truncated header": []byte{0x00, 0x00},
+		"truncated event": []byte{0x00, 0x00, 0x00, 0x02, 0x80},
+		"oversized event": []byte{0xff, 0xff, 0xff, 0xff},
+		"empty event": []byte{0x00, 0x00, 0x00, 0x00},
+		"trailing bytes": []byte{0x00, 0x00, 0x00, 0x02, 0xf6, 0xc0},
+		"invalid event": append(appendUint32(nil, uint32(len(invalidEvent))), invalidEvent...),
+	}
+	for name, stream := range cases {
+		if _, err := newDecoder(bytes.NewReader(stream)).Decode(); err == nil || err == io.EOF {
+			t.Errorf("Expected failure decoding %s but was %v", name, err)
+		}
+	}
+}
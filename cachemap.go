@@ -0,0 +1,60 @@
+/*
+Copyright 2016 Ville Koskela
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package gosteno
+
+import (
+	"sync"
+)
+
+// Map safe for concurrent use by caches which are read much more often than written.
+type cacheMap struct {
+	mutex sync.RWMutex
+	entries map[interface{}]interface{}
+	// The maximum number of entries; zero is unlimited.
+	limit int
+}
+
+func (cm *cacheMap) load(key interface{}) (interface{}, bool) {
+	cm.mutex.RLock()
+	value, ok := cm.entries[key]
+	cm.mutex.RUnlock()
+	return value, ok
+}
+
+// Store the value of the key unless the cache is full.
+func (cm *cacheMap) store(key interface{}, value interface{}) {
+	cm.mutex.Lock()
+	if cm.entries == nil {
+		cm.entries = make(map[interface{}]interface{})
+	}
+	if _, ok := cm.entries[key]; ok || cm.limit <= 0 || len(cm.entries) < cm.limit {
+		cm.entries[key] = value
+	}
+	cm.mutex.Unlock()
+}
+
+func (cm *cacheMap) size() int {
+	cm.mutex.RLock()
+	var size int = len(cm.entries)
+	cm.mutex.RUnlock()
+	return size
+}
+
+func (cm *cacheMap) clear() {
+	cm.mutex.Lock()
+	cm.entries = nil
+	cm.mutex.Unlock()
+}
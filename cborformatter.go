@@ -0,0 +1,271 @@
+/*
+Copyright 2016 Ville Koskela
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package gosteno
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"github.com/Sirupsen/logrus"
+)
+
+const (
+	cborUnsigned = 0
+	cborNegative = 1
+	cborBytes = 2
+	cborText = 3
+	cborArray = 4
+	cborMap = 5
+	cborTag = 6
+	cborSimple = 7
+	cborIndefinite = 31
+	cborBreak = 0xff
+)
+
+var (
+	_ logrus.Formatter = (*CBORFormatter)(nil)
+	_ binaryCodec = cborCodec{}
+)
+
+// CBORFormatter renders Steno events as CBOR (RFC 8949). The event is the same document as rendered by Formatter, whose
+// options apply, and is prefixed by its length as a four byte big endian integer. Use NewCBORDecoder to convert the
+// events back to Steno json.
+type CBORFormatter struct {
+	*Formatter
+}
+
+func NewCBORFormatter() *CBORFormatter {
+	return &CBORFormatter{Formatter: NewFormatter()}
+}
+
+func (cf *CBORFormatter) Format(e *logrus.Entry) ([]byte, error) {
+	return formatBinary(cf.Formatter, cborCodec{}, e)
+}
+
+type cborCodec struct {
+}
+
+func (cborCodec) appendNil(dst []byte) []byte {
+	return append(dst, 0xf6)
+}
+
+func (cborCodec) appendBool(dst []byte, v bool) []byte {
+	if v {
+		return append(dst, 0xf5)
+	}
+	return append(dst, 0xf4)
+}
+
+func (cborCodec) appendInt(dst []byte, v int64) []byte {
+	if v < 0 {
+		return appendCborHead(dst, cborNegative, uint64(-1 - v))
+	}
+	return appendCborHead(dst, cborUnsigned, uint64(v))
+}
+
+func (cborCodec) appendUint(dst []byte, v uint64) []byte {
+	return appendCborHead(dst, cborUnsigned, v)
+}
+
+func (cborCodec) appendFloat(dst []byte, v float64) []byte {
+	return appendUint64(append(dst, 0xfb), math.Float64bits(v))
+}
+
+func (cborCodec) appendFloat32(dst []byte, v float32) []byte {
+	return appendUint32(append(dst, 0xfa), math.Float32bits(v))
+}
+
+func (cborCodec) appendStringHeader(dst []byte, n int) []byte {
+	return appendCborHead(dst, cborText, uint64(n))
+}
+
+func (cborCodec) appendArrayHeader(dst []byte, n int) []byte {
+	return appendCborHead(dst, cborArray, uint64(n))
+}
+
+func (cborCodec) appendMapHeader(dst []byte, n int) []byte {
+	return appendCborHead(dst, cborMap, uint64(n))
+}
+
+func (cc cborCodec) appendJson(dst []byte, src []byte, depth int) ([]byte, []byte, error) {
+	if len(src) == 0 {
+		return dst, src, errTruncated
+	}
+	if depth > maxDecodeDepth {
+		return dst, src, fmt.Errorf("gosteno: cbor nesting exceeds maximum depth %d", maxDecodeDepth)
+	}
+	var major byte = src[0] >> 5
+	var info byte = src[0] & 0x1f
+	if major == cborSimple {
+		return cc.appendJsonSimple(dst, src[1:], info)
+	}
+	if info == cborIndefinite {
+		switch major {
+		case cborArray, cborMap:
+			return cc.appendJsonContainer(dst, src[1:], major, 0, true, depth)
+		}
+		return dst, src, fmt.Errorf("gosteno: unsupported indefinite length cbor type %d", major)
+	}
+	n, src, err := readCborArgument(src)
+	if err != nil {
+		return dst, src, err
+	}
+	var value []byte
+	switch major {
+	case cborUnsigned:
+		return strconv.AppendUint(dst, n, 10), src, nil
+	case cborNegative:
+		// The value is -1 - n which may not be representable as an int64
+		if n == math.MaxUint64 {
+			return append(dst, "-18446744073709551616"...), src, nil
+		}
+		return strconv.AppendUint(append(dst, '-'), n + 1, 10), src, nil
+	case cborBytes:
+		if value, src, err = splitBytes(src, n); err != nil {
+			return dst, src, err
+		}
+		return appendJsonBytes(dst, value), src, nil
+	case cborText:
+		if value, src, err = splitBytes(src, n); err != nil {
+			return dst, src, err
+		}
+		return appendJsonString(dst, string(value)), src, nil
+	case cborArray, cborMap:
+		return cc.appendJsonContainer(dst, src, major, n, false, depth)
+	}
+	// Tags do not affect the json encoding of the tagged value
+	return cc.appendJson(dst, src, depth + 1)
+}
+
+func (cborCodec) appendJsonSimple(dst []byte, src []byte, info byte) ([]byte, []byte, error) {
+	var value []byte
+	var err error
+	switch info {
+	case 20:
+		return append(dst, "false"...), src, nil
+	case 21:
+		return append(dst, "true"...), src, nil
+	case 22, 23:
+		return append(dst, "null"...), src, nil
+	case 25:
+		if value, src, err = splitBytes(src, 2); err != nil {
+			return dst, src, err
+		}
+		dst, err = appendDecodedFloat(dst, float64(halfToFloat32(binary.BigEndian.Uint16(value))), 32)
+		return dst, src, err
+	case 26:
+		if value, src, err = splitBytes(src, 4); err != nil {
+			return dst, src, err
+		}
+		dst, err = appendDecodedFloat(dst, float64(math.Float32frombits(binary.BigEndian.Uint32(value))), 32)
+		return dst, src, err
+	case 27:
+		if value, src, err = splitBytes(src, 8); err != nil {
+			return dst, src, err
+		}
+		dst, err = appendDecodedFloat(dst, math.Float64frombits(binary.BigEndian.Uint64(value)), 64)
+		return dst, src, err
+	}
+	return dst, src, fmt.Errorf("gosteno: unsupported cbor simple value %d", info)
+}
+
+func (cc cborCodec) appendJsonContainer(dst []byte, src []byte, major byte, n uint64, indefinite bool, depth int) ([]byte, []byte, error) {
+	var err error
+	var end byte = ']'
+	if major == cborMap {
+		dst = append(dst, '{')
+		end = '}'
+	} else {
+		dst = append(dst, '[')
+	}
+	for i := uint64(0); indefinite || i < n; i++ {
+		if len(src) == 0 {
+			return dst, src, errTruncated
+		}
+		if indefinite && src[0] == cborBreak {
+			src = src[1:]
+			break
+		}
+		if i > 0 {
+			dst = append(dst, ',')
+		}
+		if major == cborMap {
+			if src[0] >> 5 != cborText || src[0] & 0x1f == cborIndefinite {
+				return dst, src, fmt.Errorf("gosteno: unsupported cbor map key type 0x%02x", src[0])
+			}
+			if dst, src, err = cc.appendJson(dst, src, depth + 1); err != nil {
+				return dst, src, err
+			}
+			dst = append(dst, ':')
+		}
+		if dst, src, err = cc.appendJson(dst, src, depth + 1); err != nil {
+			return dst, src, err
+		}
+	}
+	return append(dst, end), src, nil
+}
+
+// Append the initial byte and argument of a data item of the major type.
+func appendCborHead(dst []byte, major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return append(dst, major << 5 | byte(n))
+	case n <= math.MaxUint8:
+		return append(dst, major << 5 | 24, byte(n))
+	case n <= math.MaxUint16:
+		return appendUint16(append(dst, major << 5 | 25), uint16(n))
+	case n <= math.MaxUint32:
+		return appendUint32(append(dst, major << 5 | 26), uint32(n))
+	}
+	return appendUint64(append(dst, major << 5 | 27), n)
+}
+
+// Read the argument of the data item returning the remainder following the argument.
+func readCborArgument(src []byte) (uint64, []byte, error) {
+	var info byte = src[0] & 0x1f
+	if info < 24 {
+		return uint64(info), src[1:], nil
+	}
+	if info > 27 {
+		return 0, src, fmt.Errorf("gosteno: unsupported cbor additional information %d", info)
+	}
+	value, rest, err := splitBytes(src[1:], 1 << (info - 24))
+	if err != nil {
+		return 0, src, err
+	}
+	return readUint(value), rest, nil
+}
+
+// Convert an IEEE 754 half precision float to single precision.
+func halfToFloat32(h uint16) float32 {
+	var sign uint32 = uint32(h >> 15) << 31
+	var exponent uint32 = uint32(h >> 10) & 0x1f
+	var mantissa uint32 = uint32(h) & 0x3ff
+	switch exponent {
+	case 0:
+		// Zero or subnormal
+		var f float32 = float32(mantissa) / (1 << 24)
+		if sign != 0 {
+			return -f
+		}
+		return f
+	case 0x1f:
+		// Infinity or NaN
+		return math.Float32frombits(sign | 0xff << 23 | mantissa << 13)
+	}
+	return math.Float32frombits(sign | (exponent + 127 - 15) << 23 | mantissa << 13)
+}
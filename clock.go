@@ -0,0 +1,57 @@
+/*
+Copyright 2016 Ville Koskela
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package gosteno
+
+import (
+	"time"
+)
+
+var (
+	_ Clock = (*SystemClock)(nil)
+	_ Clock = (*FixedClock)(nil)
+)
+
+// Clock interface for supplying the time of events.
+type Clock interface {
+
+	// The current time.
+	Now() time.Time
+}
+
+// SystemClock supplies the current system time.
+type SystemClock struct {
+}
+
+func NewSystemClock() *SystemClock {
+	return &SystemClock{}
+}
+
+func (sc *SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+// FixedClock always supplies the same time; for example, to produce byte-exact output in tests.
+type FixedClock struct {
+	time time.Time
+}
+
+func NewFixedClock(t time.Time) *FixedClock {
+	return &FixedClock{time: t}
+}
+
+func (fc *FixedClock) Now() time.Time {
+	return fc.time
+}
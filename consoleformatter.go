@@ -0,0 +1,510 @@
+/*
+Copyright 2016 Ville Koskela
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package gosteno
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+	"github.com/Sirupsen/logrus"
+)
+
+const (
+	defaultConsoleTimeLayout = "15:04:05.000"
+	consoleLevelWidth = 5
+	consoleExceptionKey = "exception"
+	consoleContextPrefix = "context."
+	colorReset = "\x1b[0m"
+	colorBold = "\x1b[1m"
+	colorRed = "\x1b[31m"
+	colorYellow = "\x1b[33m"
+	colorMagenta = "\x1b[35m"
+	colorCyan = "\x1b[36m"
+	colorGray = "\x1b[37m"
+	colorDarkGray = "\x1b[90m"
+)
+
+var (
+	_ logrus.Formatter = (*ConsoleFormatter)(nil)
+
+	// Colors of the levels.
+	consoleLevelColors = map[logrus.Level]string{
+		traceLevel: colorGray,
+		logrus.DebugLevel: colorGray,
+		logrus.InfoLevel: colorCyan,
+		logrus.WarnLevel: colorYellow,
+		logrus.ErrorLevel: colorRed,
+		logrus.FatalLevel: colorMagenta,
+		logrus.PanicLevel: colorMagenta,
+	}
+)
+
+// ConsoleFormatter renders events for humans (e.g. during local development) instead of as Steno JSON. The time, level,
+// logger name, event name and message are rendered on the first line followed by the data, context and exception each
+// on an aligned line. The options of Formatter rendering these (e.g. the level names, redactor and limits) are provided
+// as well; context is rendered as logged and no keys are injected. Control characters, including those of escape
+// sequences, are escaped. Events are colored when the output is a terminal.
+type ConsoleFormatter struct {
+	formatter *Formatter
+	timeLayout string
+	forceColors bool
+	disableColors bool
+	terminalOnce sync.Once
+	isTerminal bool
+}
+
+func NewConsoleFormatter() *ConsoleFormatter {
+	return &ConsoleFormatter{
+		formatter: NewFormatter(),
+		timeLayout: defaultConsoleTimeLayout,
+		forceColors: false,
+		disableColors: false,
+	}
+}
+
+func (cf *ConsoleFormatter) Format(e *logrus.Entry) ([]byte, error) {
+	var buffer *[]byte = getBuffer()
+	var b []byte = *buffer
+	var colored bool = cf.isColored(e)
+	var level string = cf.formatter.getLevel(e)
+	var levelColor string = consoleLevelColors[e.Level]
+
+	// Header line
+	var timeLayout string = cf.timeLayout
+	if timeLayout == "" {
+		timeLayout = defaultConsoleTimeLayout
+	}
+	var lineStart int = len(b)
+	var location *time.Location = cf.formatter.timeLocation
+	if location == nil {
+		location = time.UTC
+	}
+	b = getEntryTime(e).In(location).AppendFormat(b, timeLayout)
+	b = append(b, ' ')
+	b = appendColored(b, colored, levelColor, strings.ToUpper(level))
+	for i := len(level); i < consoleLevelWidth; i++ {
+		b = append(b, ' ')
+	}
+	b = append(b, ' ')
+	var indent string = strings.Repeat(" ", len(b) - lineStart - cf.colorWidth(colored, levelColor))
+
+	data, hasValidMarker := getEntryData(e)
+	context, loggerName := getEntryContext(e)
+	var event string = getEntryEvent(e)
+	if loggerName != "" {
+		b = appendColored(b, colored, colorDarkGray, cf.formatter.loggerNameAbbreviator.abbreviate(loggerName))
+		if event != "" {
+			b = append(b, ' ')
+		}
+	}
+	if event != "" {
+		b = appendColored(b, colored, colorBold, event)
+	}
+	if e.Message != "" {
+		if loggerName != "" || event != "" {
+			b = append(b, ": "...)
+		}
+		var message string = e.Message
+		if cf.formatter.redactor != nil {
+			message = cf.formatter.redactor.redactMessage(message)
+		}
+		b = appendConsoleMessage(b, indent, truncateString(message, cf.formatter.maxStringLength))
+	}
+	b = append(b, '\n')
+
+	// Data, context and exception lines
+	var dataKeys []string = cf.getConsoleKeys(data, e.Message != "", hasValidMarker)
+	var contextKeys []string = cf.getConsoleKeys(context, false, true)
+	var entryError error = getEntryError(e)
+	var keyWidth int = 0
+	for _, key := range dataKeys {
+		if len(key) > keyWidth {
+			keyWidth = len(key)
+		}
+	}
+	for _, key := range contextKeys {
+		if len(consoleContextPrefix) + len(key) > keyWidth {
+			keyWidth = len(consoleContextPrefix) + len(key)
+		}
+	}
+	if entryError != nil {
+		if len(consoleExceptionKey) > keyWidth {
+			keyWidth = len(consoleExceptionKey)
+		}
+	}
+	for _, key := range dataKeys {
+		b = appendConsoleKey(b, colored, levelColor, indent, keyWidth, key)
+		b = append(cf.appendConsoleValue(b, e, "data", key, data[key]), '\n')
+	}
+	for _, key := range contextKeys {
+		b = appendConsoleKey(b, colored, colorDarkGray, indent, keyWidth, consoleContextPrefix + key)
+		b = append(cf.appendConsoleValue(b, e, "context", key, context[key]), '\n')
+	}
+	if entryError != nil {
+		b = appendConsoleKey(b, colored, colorRed, indent, keyWidth, consoleExceptionKey)
+		b = cf.appendConsoleError(b, e, entryError)
+		var valueIndent string = indent + strings.Repeat(" ", keyWidth + 3)
+		for _, line := range cf.formatter.getBacktrace(e) {
+			b = append(b, valueIndent...)
+			b = append(b, "at "...)
+			b = appendConsoleEscaped(b, line)
+			b = append(b, '\n')
+		}
+		if cf.formatter.injectExceptionCauses {
+			b = cf.appendConsoleCauses(b, e, valueIndent, entryError, 1)
+		}
+	}
+	return completeFormat(e, buffer, b), nil
+}
+
+func (cf *ConsoleFormatter) TimeLayout() string {
+	return cf.timeLayout
+}
+
+// Set the layout of the event time (see time.Layout). The default is "15:04:05.000".
+func (cf *ConsoleFormatter) SetTimeLayout(v string) {
+	cf.timeLayout = v
+}
+
+func (cf *ConsoleFormatter) ForceColors() bool {
+	return cf.forceColors
+}
+
+// Set whether events are colored even if the output is not a terminal. The default is false.
+func (cf *ConsoleFormatter) SetForceColors(v bool) {
+	cf.forceColors = v
+}
+
+func (cf *ConsoleFormatter) DisableColors() bool {
+	return cf.disableColors
+}
+
+// Set whether events are never colored. The default is false.
+func (cf *ConsoleFormatter) SetDisableColors(v bool) {
+	cf.disableColors = v
+}
+
+func (cf *ConsoleFormatter) TimeLocation() *time.Location {
+	return cf.formatter.TimeLocation()
+}
+
+// Set the time zone the event time is rendered in; see Formatter.SetTimeLocation.
+func (cf *ConsoleFormatter) SetTimeLocation(v *time.Location) {
+	cf.formatter.SetTimeLocation(v)
+}
+
+// The level name of events at the specified level.
+func (cf *ConsoleFormatter) LevelName(l logrus.Level) string {
+	return cf.formatter.LevelName(l)
+}
+
+// Set the level name of events at the level; see Formatter.SetLevelName.
+func (cf *ConsoleFormatter) SetLevelName(l logrus.Level, v string) error {
+	return cf.formatter.SetLevelName(l, v)
+}
+
+func (cf *ConsoleFormatter) StrictLevelNames() bool {
+	return cf.formatter.StrictLevelNames()
+}
+
+// Set whether level names must be Steno levels; see Formatter.SetStrictLevelNames.
+func (cf *ConsoleFormatter) SetStrictLevelNames(v bool) error {
+	return cf.formatter.SetStrictLevelNames(v)
+}
+
+func (cf *ConsoleFormatter) LoggerNameLength() int {
+	return cf.formatter.LoggerNameLength()
+}
+
+// Set the target length of the logger name; see Formatter.SetLoggerNameLength.
+func (cf *ConsoleFormatter) SetLoggerNameLength(v int) {
+	cf.formatter.SetLoggerNameLength(v)
+}
+
+func (cf *ConsoleFormatter) InjectBacktrace(l logrus.Level) bool {
+	return cf.formatter.InjectBacktrace(l)
+}
+
+// Set whether the backtrace is rendered at the level; see Formatter.SetInjectBacktrace.
+func (cf *ConsoleFormatter) SetInjectBacktrace(l logrus.Level, v bool) {
+	cf.formatter.SetInjectBacktrace(l, v)
+}
+
+func (cf *ConsoleFormatter) BacktraceDepth() int {
+	return cf.formatter.BacktraceDepth()
+}
+
+// Set the maximum number of frames in the backtrace; see Formatter.SetBacktraceDepth.
+func (cf *ConsoleFormatter) SetBacktraceDepth(v int) {
+	cf.formatter.SetBacktraceDepth(v)
+}
+
+func (cf *ConsoleFormatter) BacktraceFilters() []string {
+	return cf.formatter.BacktraceFilters()
+}
+
+// Set the function name prefixes of frames to exclude from the backtrace; see Formatter.SetBacktraceFilters.
+func (cf *ConsoleFormatter) SetBacktraceFilters(v []string) {
+	cf.formatter.SetBacktraceFilters(v)
+}
+
+func (cf *ConsoleFormatter) InjectExceptionCauses() bool {
+	return cf.formatter.InjectExceptionCauses()
+}
+
+// Set whether the causes of the error are rendered; see Formatter.SetInjectExceptionCauses.
+func (cf *ConsoleFormatter) SetInjectExceptionCauses(v bool) {
+	cf.formatter.SetInjectExceptionCauses(v)
+}
+
+func (cf *ConsoleFormatter) Redactor() *Redactor {
+	return cf.formatter.Redactor()
+}
+
+// Set the redactor; see Formatter.SetRedactor.
+func (cf *ConsoleFormatter) SetRedactor(v *Redactor) {
+	cf.formatter.SetRedactor(v)
+}
+
+func (cf *ConsoleFormatter) MaxDepth() int {
+	return cf.formatter.MaxDepth()
+}
+
+// Set the maximum nesting of values; see Formatter.SetMaxDepth.
+func (cf *ConsoleFormatter) SetMaxDepth(v int) {
+	cf.formatter.SetMaxDepth(v)
+}
+
+func (cf *ConsoleFormatter) MaxElements() int {
+	return cf.formatter.MaxElements()
+}
+
+// Set the maximum number of elements of arrays and objects within values; see Formatter.SetMaxElements.
+func (cf *ConsoleFormatter) SetMaxElements(v int) {
+	cf.formatter.SetMaxElements(v)
+}
+
+func (cf *ConsoleFormatter) MaxStringLength() int {
+	return cf.formatter.MaxStringLength()
+}
+
+// Set the maximum length in bytes of the message and strings within values; see Formatter.SetMaxStringLength.
+func (cf *ConsoleFormatter) SetMaxStringLength(v int) {
+	cf.formatter.SetMaxStringLength(v)
+}
+
+// The encoder registered for the type; nil if none.
+func (cf *ConsoleFormatter) Encoder(t reflect.Type) ValueEncoder {
+	return cf.formatter.Encoder(t)
+}
+
+// Register the encoder of values of the type; see Formatter.RegisterEncoder.
+func (cf *ConsoleFormatter) RegisterEncoder(t reflect.Type, encoder ValueEncoder) {
+	cf.formatter.RegisterEncoder(t, encoder)
+}
+
+func (cf *ConsoleFormatter) ErrorHandler() ErrorHandler {
+	return cf.formatter.ErrorHandler()
+}
+
+// Set the handler of failures encountered while formatting; see Formatter.SetErrorHandler.
+func (cf *ConsoleFormatter) SetErrorHandler(v ErrorHandler) {
+	cf.formatter.SetErrorHandler(v)
+}
+
+// The number of internal failures encountered while formatting events.
+func (cf *ConsoleFormatter) ErrorCount() uint64 {
+	return cf.formatter.ErrorCount()
+}
+
+// Whether the event is colored; the output of the logger is checked once as with the logrus text formatter.
+func (cf *ConsoleFormatter) isColored(e *logrus.Entry) bool {
+	if cf.disableColors {
+		return false
+	}
+	if cf.forceColors {
+		return true
+	}
+	cf.terminalOnce.Do(func() {
+		if e.Logger != nil {
+			cf.isTerminal = isTerminal(e.Logger.Out)
+		}
+	})
+	return cf.isTerminal
+}
+
+// The number of bytes of escape sequences appended when coloring a value.
+func (cf *ConsoleFormatter) colorWidth(colored bool, color string) int {
+	if colored && color != "" {
+		return len(color) + len(colorReset)
+	}
+	return 0
+}
+
+// Whether the writer is a terminal (i.e. a character device).
+func isTerminal(w io.Writer) bool {
+	if file, ok := w.(*os.File); ok {
+		if info, err := file.Stat(); err == nil {
+			return info.Mode() & os.ModeCharDevice != 0
+		}
+	}
+	return false
+}
+
+// Return the sorted keys of the values to render; see Formatter.writeData for the keys which are excluded. Keys dropped
+// by the redactor are excluded as well.
+func (cf *ConsoleFormatter) getConsoleKeys(values map[string]interface{}, hasMessage bool, hasValidMarker bool) []string {
+	var keys []string = make([]string, 0, len(values))
+	for key := range values {
+		if key == "message" && hasMessage {
+			continue
+		}
+		if !hasValidMarker && isInternalKey(key) {
+			continue
+		}
+		if cf.formatter.redactor != nil {
+			if rule := cf.formatter.redactor.lookup(key); rule != nil && rule.mode == RedactionModeDrop {
+				continue
+			}
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Append the value of the key in the block as rendered by Formatter; strings are rendered verbatim unless quoting is
+// required to preserve the layout and other values are rendered as json.
+func (cf *ConsoleFormatter) appendConsoleValue(b []byte, e *logrus.Entry, block string, key string, value interface{}) []byte {
+	var buffer *[]byte = getBuffer()
+	var w *eventWriter = getEventWriter(eventFormatJson, nil, *buffer)
+	var rule *redactionRule
+	if cf.formatter.redactor != nil {
+		rule = cf.formatter.redactor.lookup(key)
+	}
+	if rule != nil {
+		w.writeString(cf.formatter.redactor.redact(rule.mode, value))
+	} else {
+		cf.formatter.writeValue(w, e, block, key, value)
+	}
+	var document []byte = putEventWriter(w)
+	var s string
+	if document[0] == '"' && json.Unmarshal(document, &s) == nil {
+		b = appendConsoleString(b, s)
+	} else if bytes.IndexFunc(document, isConsoleControl) >= 0 {
+		b = appendConsoleEscaped(b, string(document))
+	} else {
+		b = append(b, document...)
+	}
+	*buffer = document
+	putBuffer(buffer)
+	return b
+}
+
+// Append the value colored; the value is escaped.
+func appendColored(b []byte, colored bool, color string, value string) []byte {
+	if !colored || color == "" {
+		return appendConsoleEscaped(b, value)
+	}
+	b = append(b, color...)
+	b = appendConsoleEscaped(b, value)
+	return append(b, colorReset...)
+}
+
+func appendConsoleKey(b []byte, colored bool, color string, indent string, keyWidth int, key string) []byte {
+	b = append(b, indent...)
+	b = appendColored(b, colored, color, key)
+	for i := len(key); i < keyWidth; i++ {
+		b = append(b, ' ')
+	}
+	return append(b, " = "...)
+}
+
+// Append the string verbatim unless quoting is required to preserve the layout (e.g. it is empty, is padded or
+// contains control characters).
+func appendConsoleString(b []byte, s string) []byte {
+	if s == "" || strings.TrimSpace(s) != s || strings.IndexFunc(s, isConsoleControl) >= 0 || !utf8.ValidString(s) {
+		return strconv.AppendQuote(b, s)
+	}
+	return append(b, s...)
+}
+
+// Append the message continuing each of its lines at the indent.
+func appendConsoleMessage(b []byte, indent string, message string) []byte {
+	for {
+		var i int = strings.IndexByte(message, '\n')
+		if i < 0 {
+			return appendConsoleEscaped(b, message)
+		}
+		b = appendConsoleEscaped(b, message[:i])
+		b = append(b, '\n')
+		b = append(b, indent...)
+		message = message[i + 1:]
+	}
+}
+
+// Append the text escaping control characters and invalid utf-8 such that it cannot alter the terminal (e.g. with an
+// ANSI escape sequence) or the layout.
+func appendConsoleEscaped(b []byte, s string) []byte {
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			b = append(b, `\x`...)
+			b = append(b, hexDigits[s[i] >> 4], hexDigits[s[i] & 0xF])
+		} else if isConsoleControl(r) {
+			var quoted string = strconv.QuoteRune(r)
+			b = append(b, quoted[1:len(quoted) - 1]...)
+		} else {
+			b = append(b, s[i:i + size]...)
+		}
+		i += size
+	}
+	return b
+}
+
+// Whether the rune is a C0 or C1 control character (e.g. ESC and CSI introducing ANSI escape sequences).
+func isConsoleControl(r rune) bool {
+	return r < 0x20 || (r >= 0x7F && r <= 0x9F)
+}
+
+func (cf *ConsoleFormatter) appendConsoleError(b []byte, e *logrus.Entry, err error) []byte {
+	b = appendConsoleEscaped(b, getErrorType(err))
+	b = append(b, ": "...)
+	b = appendConsoleString(b, cf.formatter.getErrorMessage(e, err))
+	return append(b, '\n')
+}
+
+// Append the causes of the error, each indented by its depth.
+func (cf *ConsoleFormatter) appendConsoleCauses(b []byte, e *logrus.Entry, indent string, err error, depth int) []byte {
+	if depth > maxCauseDepth {
+		return b
+	}
+	for _, cause := range unwrapCauses(err) {
+		b = append(b, indent...)
+		b = append(b, "caused by "...)
+		b = cf.appendConsoleError(b, e, cause)
+		b = cf.appendConsoleCauses(b, e, indent + "  ", cause, depth + 1)
+	}
+	return b
+}
@@ -0,0 +1,199 @@
+/*
+Copyright 2016 Ville Koskela
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package gosteno
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+	"github.com/Sirupsen/logrus"
+)
+
+const (
+	consoleFormatterTestDataPath = "./testdata/consoleformatter_test/"
+)
+
+var (
+	consoleFormatterTestTime = time.Date(2016, 1, 2, 3, 4, 5, 60000000, time.UTC)
+)
+
+func TestConsoleFormatterDefaults(t *testing.T) {
+	var formatter *ConsoleFormatter = NewConsoleFormatter()
+	if v := formatter.TimeLayout(); v != "15:04:05.000" {
+		t.Errorf("Incorrect default value for time layout %v", v)
+	}
+	if v := formatter.ForceColors(); v != false {
+		t.Errorf("Incorrect default value for force colors %v", v)
+	}
+	if v := formatter.DisableColors(); v != false {
+		t.Errorf("Incorrect default value for disable colors %v", v)
+	}
+	if v := formatter.TimeLocation(); v != time.UTC {
+		t.Errorf("Incorrect default value for time location %v", v)
+	}
+	if v := formatter.LoggerNameLength(); v != 0 {
+		t.Errorf("Incorrect default value for logger name length %v", v)
+	}
+	if v := formatter.InjectExceptionCauses(); v != true {
+		t.Errorf("Incorrect default value for inject exception causes %v", v)
+	}
+}
+
+func TestConsoleFormatterMessage(t *testing.T) {
+	t.Parallel()
+	logger, buffer := helperTestGetConsoleLogger("TestConsoleFormatterMessage", NewConsoleFormatter())
+	logger.InfoBuilder().SetMessage("TestConsoleFormatterMessage").Log()
+	helperTestVerifyConsole(t, buffer, "TestConsoleFormatterMessage")
+}
+
+func TestConsoleFormatterDataAndContext(t *testing.T) {
+	t.Parallel()
+	logger, buffer := helperTestGetConsoleLogger("TestConsoleFormatterDataAndContext", NewConsoleFormatter())
+	logger.WarnBuilder().
+			SetEvent("my_event").
+			SetMessage("TestConsoleFormatterDataAndContext\nwith a second line").
+			AddData("userId", "bb486dfd").
+			AddData("count", 3).
+			AddData("widget", createWidget("TestConsoleFormatterDataAndContext")).
+			AddData("padded", " padded ").
+			AddContext("requestId", "3186ea94").
+			Log()
+	helperTestVerifyConsole(t, buffer, "TestConsoleFormatterDataAndContext")
+}
+
+func TestConsoleFormatterLogrusError(t *testing.T) {
+	t.Parallel()
+	var err error = &testWrappedError{testDomainError{"request failed: timeout\nrefused"},
+		&testJoinedError{testDomainError{"timeout\nrefused"}, []error{errors.New("timeout"), errors.New("refused")}}}
+	var entry *logrus.Entry = &logrus.Entry{
+		Time: consoleFormatterTestTime,
+		Level: logrus.ErrorLevel,
+		Message: "TestConsoleFormatterLogrusError",
+		Data: logrus.Fields{logrus.ErrorKey: err, "attempt": 2},
+	}
+	result, _ := NewConsoleFormatter().Format(entry)
+	helperTestVerifyConsole(t, bytes.NewBuffer(result), "TestConsoleFormatterLogrusError")
+}
+
+func TestConsoleFormatterBacktrace(t *testing.T) {
+	t.Parallel()
+	logger, buffer := helperTestGetConsoleLogger("TestConsoleFormatterBacktrace", NewConsoleFormatter())
+	logger.ErrorBuilder().SetMessage("TestConsoleFormatterBacktrace").SetError(errors.New("failure")).Log()
+	var lines []string = strings.Split(buffer.String(), "\n")
+	if len(lines) < 3 ||
+			lines[1] != "                   exception = *errors.errorString: failure" ||
+			!strings.HasPrefix(lines[2], "                               at testing.tRunner(") {
+		t.Errorf("Incorrect backtrace in %s", buffer.String())
+	}
+}
+
+func TestConsoleFormatterColors(t *testing.T) {
+	t.Parallel()
+	var formatter *ConsoleFormatter = NewConsoleFormatter()
+	formatter.SetForceColors(true)
+	logger, buffer := helperTestGetConsoleLogger("TestConsoleFormatterColors", formatter)
+	logger.ErrorBuilder().SetMessage("TestConsoleFormatterColors").AddData("key", "value").Log()
+	helperTestVerifyConsole(t, buffer, "TestConsoleFormatterColors")
+}
+
+func TestConsoleFormatterOptions(t *testing.T) {
+	t.Parallel()
+	var formatter *ConsoleFormatter = NewConsoleFormatter()
+	var redactor *Redactor = NewRedactor()
+	redactor.AddKey("password", RedactionModeDrop)
+	redactor.AddKey("token", RedactionModeMask)
+	formatter.SetRedactor(redactor)
+	formatter.SetMaxStringLength(16)
+	formatter.SetLevelName(logrus.InfoLevel, "warn")
+	logger, buffer := helperTestGetConsoleLogger("TestConsoleFormatterOptions", formatter)
+	logger.InfoBuilder().
+			SetMessage("token=abc TestConsoleFormatterOptions").
+			AddData("password", "secret").
+			AddData("token", "abc").
+			AddData("long", "0123456789abcdefghij").
+			AddData("list", []int{1, 2, 3}).
+			AddContext("password", "secret").
+			Log()
+	helperTestVerifyConsole(t, buffer, "TestConsoleFormatterOptions")
+}
+
+func TestConsoleFormatterNameLocationAndCauses(t *testing.T) {
+	t.Parallel()
+	var formatter *ConsoleFormatter = NewConsoleFormatter()
+	formatter.SetLoggerNameLength(24)
+	formatter.SetTimeLocation(time.FixedZone("UTC+2", 2 * 60 * 60))
+	formatter.SetInjectExceptionCauses(false)
+	formatter.SetInjectBacktrace(logrus.ErrorLevel, false)
+	logger, buffer := helperTestGetConsoleLogger("github.com/acme/platform/billing/invoices.worker", formatter)
+	logger.ErrorBuilder().
+			SetMessage("TestConsoleFormatterNameLocationAndCauses").
+			SetError(&testWrappedError{testDomainError{"request failed: timeout"}, errors.New("timeout")}).
+			Log()
+	helperTestVerifyConsole(t, buffer, "TestConsoleFormatterNameLocationAndCauses")
+}
+
+func TestConsoleFormatterEscaping(t *testing.T) {
+	t.Parallel()
+	logger, buffer := helperTestGetConsoleLogger("TestConsoleFormatterEscaping", NewConsoleFormatter())
+	logger.InfoBuilder().
+			SetEvent("my_\x1b[2Jevent").
+			SetMessage("TestConsoleFormatterEscaping\x1b[31m\r\nsecond\u009b1A line").
+			AddData("key\x1b]0;title\x07", "value\x1b[0m").
+			AddData("nested", map[string]interface{}{"value": "\u009b2J"}).
+			Log()
+	helperTestVerifyConsole(t, buffer, "TestConsoleFormatterEscaping")
+}
+
+func TestConsoleFormatterTerminal(t *testing.T) {
+	if isTerminal(new(bytes.Buffer)) {
+		t.Errorf("Buffer detected as terminal")
+	}
+	file, err := ioutil.TempFile("", "TestConsoleFormatterTerminal")
+	if err != nil {
+		t.Fatalf("Failed to create temporary file %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+	if isTerminal(file) {
+		t.Errorf("File detected as terminal")
+	}
+}
+
+func helperTestGetConsoleLogger(n string, f *ConsoleFormatter) (*Logger, *bytes.Buffer) {
+	var buffer *bytes.Buffer = new(bytes.Buffer)
+	var logrusLogger *logrus.Logger = &logrus.Logger{
+		Out: buffer,
+		Formatter: f,
+		Level: logrus.DebugLevel,
+	}
+	return GetLoggerForLogger(n, logrusLogger).WithClock(NewFixedClock(consoleFormatterTestTime)), buffer
+}
+
+func helperTestVerifyConsole(t *testing.T, actualBuffer *bytes.Buffer, name string) {
+	var expectedBuffer []byte
+	var err error
+	if expectedBuffer, err = ioutil.ReadFile(consoleFormatterTestDataPath + name + ".expected.txt"); err != nil {
+		t.Errorf("Failed to read expected file for %s", name)
+		return
+	}
+	if !bytes.Equal(expectedBuffer, actualBuffer.Bytes()) {
+		t.Errorf("Actual log message does not match expected; expected is\n%s\nbut actual was\n%s", string(expectedBuffer), actualBuffer.String())
+	}
+}
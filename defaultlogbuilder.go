@@ -16,11 +16,12 @@ limitations under the License.
 package gosteno
 
 import (
+	"encoding/json"
 	"github.com/Sirupsen/logrus"
 )
 
 var (
-	_ LogBuilder = (*DefaultLogBuilder)(nil)
+	_ DataLogBuilder = (*DefaultLogBuilder)(nil)
 )
 
 // DefaultLogBuilder is the default LogBuilder implementation that satisfies the LogBuilder contract.
@@ -29,9 +30,14 @@ type DefaultLogBuilder struct {
 	level logrus.Level
 	event string
 	loggerName string
+	threadId string
+	clock Clock
 	message string
 	err error
+	stack stack
 	data map[string]interface{}
+	dataJson json.RawMessage
+	object interface{}
 	context map[string]interface{}
 }
 
@@ -44,6 +50,12 @@ func NewDefaultLogBuilder(l *logrus.Logger, v logrus.Level, n string) *DefaultLo
 			context: make(map[string]interface{})}
 }
 
+// Set the Clock supplying the time of the event instead of the time assigned by logrus (e.g. a FixedClock in tests).
+func (dlb *DefaultLogBuilder) SetClock(clock Clock) *DefaultLogBuilder {
+	dlb.clock = clock
+	return dlb
+}
+
 func (dlb *DefaultLogBuilder) SetEvent(event string) LogBuilder {
 	dlb.event = event
 	return dlb
@@ -56,6 +68,11 @@ func (dlb *DefaultLogBuilder) SetMessage(message string) LogBuilder {
 
 func (dlb *DefaultLogBuilder) SetError(err error) LogBuilder {
 	dlb.err = err
+	if err != nil {
+		dlb.stack = captureStack(1)
+	} else {
+		dlb.stack = nil
+	}
 	return dlb
 }
 
@@ -64,20 +81,79 @@ func (dlb *DefaultLogBuilder) AddData(key string, value interface{}) LogBuilder
 	return dlb
 }
 
+func (dlb *DefaultLogBuilder) AddDataFunc(key string, f func() interface{}) DataLogBuilder {
+	dlb.data[key] = Lazy(f)
+	return dlb
+}
+
+func (dlb *DefaultLogBuilder) AddDataRaw(key string, value json.RawMessage) DataLogBuilder {
+	dlb.data[key] = value
+	return dlb
+}
+
+func (dlb *DefaultLogBuilder) SetDataJSON(data []byte) DataLogBuilder {
+	dlb.dataJson = data
+	return dlb
+}
+
+func (dlb *DefaultLogBuilder) SetDataObject(object interface{}) DataLogBuilder {
+	dlb.object = object
+	return dlb
+}
+
 func (dlb *DefaultLogBuilder) AddContext(key string, value interface{}) LogBuilder {
 	dlb.context[key] = value
 	return dlb
 }
 
 func (dlb *DefaultLogBuilder) Log() {
-	var entry *logrus.Entry = MarkerMaps.Encode(
-		dlb.logger,
-		dlb.event,
-		dlb.loggerName,
-		dlb.data,
-		dlb.context,
-		dlb.err,
-	)
+	var entry *logrus.Entry
+	if dlb.dataJson != nil {
+		var data map[string]interface{} = dlb.data
+		var context map[string]interface{} = dlb.context
+		if dlb.object != nil {
+			data = parseObjectFields(dlb.object, false, data)
+			context = parseObjectFields(dlb.object, true, context)
+		}
+		entry = MarkerJSON.encode(
+			dlb.logger,
+			dlb.event,
+			dlb.loggerName,
+			dlb.dataJson,
+			data,
+			nil,
+			context,
+			dlb.err,
+			dlb.stack,
+		)
+	} else if dlb.object != nil {
+		entry = MarkerObject.encode(
+			dlb.logger,
+			dlb.event,
+			dlb.loggerName,
+			dlb.object,
+			dlb.data,
+			dlb.context,
+			dlb.err,
+			dlb.stack,
+		)
+	} else {
+		entry = MarkerMaps.encode(
+			dlb.logger,
+			dlb.event,
+			dlb.loggerName,
+			dlb.data,
+			dlb.context,
+			dlb.err,
+			dlb.stack,
+		)
+	}
+	if dlb.threadId != "" {
+		entry.Data[ThreadKey] = dlb.threadId
+	}
+	if dlb.clock != nil {
+		entry.Data[TimeKey] = dlb.clock.Now()
+	}
 	output(entry, dlb.message, dlb.logger, dlb.level)
 }
 
@@ -0,0 +1,220 @@
+/*
+Copyright 2016 Ville Koskela
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package gosteno
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"unicode/utf8"
+)
+
+const (
+	initialBufferSize = 1024
+	maxPooledBufferSize = 64 * 1024
+	hexDigits = "0123456789abcdef"
+)
+
+var (
+	// Pool of buffers for encoding events.
+	bufferPool = sync.Pool{
+		New: func() interface{} {
+			var buffer []byte = make([]byte, 0, initialBufferSize)
+			return &buffer
+		},
+	}
+
+	// Whether the byte is encoded as is within a json string; escaped characters and bytes of multibyte characters
+	// are not.
+	jsonSafeSet = func() (set [256]bool) {
+		for b := 0x20; b < utf8.RuneSelf; b++ {
+			set[b] = b != '"' && b != '\\' && b != '<' && b != '>' && b != '&'
+		}
+		return set
+	}()
+)
+
+func getBuffer() *[]byte {
+	return bufferPool.Get().(*[]byte)
+}
+
+func putBuffer(buffer *[]byte) {
+	if cap(*buffer) <= maxPooledBufferSize {
+		*buffer = (*buffer)[:0]
+		bufferPool.Put(buffer)
+	}
+}
+
+// Append the json encoding of the key followed by a colon.
+func appendJsonKey(dst []byte, key string) []byte {
+	return append(appendJsonString(dst, key), ':')
+}
+
+// Append the json encoding of the string; the escaping is consistent with encoding/json including the replacement of
+// invalid UTF-8 and the escaping of HTML characters.
+func appendJsonString(dst []byte, s string) []byte {
+	dst = append(dst, '"')
+	var start int = 0
+	for i := 0; i < len(s); {
+		if b := s[i]; b < utf8.RuneSelf {
+			if jsonSafeSet[b] {
+				i++
+				continue
+			}
+			dst = append(dst, s[start:i]...)
+			switch b {
+			case '"', '\\':
+				dst = append(dst, '\\', b)
+			case '\n':
+				dst = append(dst, '\\', 'n')
+			case '\r':
+				dst = append(dst, '\\', 'r')
+			case '\t':
+				dst = append(dst, '\\', 't')
+			default:
+				dst = append(dst, '\\', 'u', '0', '0', hexDigits[b >> 4], hexDigits[b & 0xF])
+			}
+			i++
+			start = i
+			continue
+		}
+		c, size := utf8.DecodeRuneInString(s[i:])
+		if c == utf8.RuneError && size == 1 {
+			dst = append(dst, s[start:i]...)
+			dst = append(dst, "\ufffd"...)
+			i += size
+			start = i
+			continue
+		}
+		if c == '\u2028' || c == '\u2029' {
+			dst = append(dst, s[start:i]...)
+			dst = append(dst, '\\', 'u', '2', '0', '2', hexDigits[c & 0xF])
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	dst = append(dst, s[start:]...)
+	return append(dst, '"')
+}
+
+// Whether the bytes require escaping to be encoded as a json string.
+func needsJsonEscape(s []byte) bool {
+	for _, b := range s {
+		if !jsonSafeSet[b] {
+			return true
+		}
+	}
+	return false
+}
+
+// Append the json encoding of the value. Common scalar types are encoded without reflection; other types are encoded
+// with encoding/json. A value failing to encode is isolated as a placeholder and the failure is returned.
+func appendJsonValue(dst []byte, value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case nil:
+		return append(dst, "null"...), nil
+	case string:
+		return appendJsonString(dst, v), nil
+	case bool:
+		return strconv.AppendBool(dst, v), nil
+	case int:
+		return strconv.AppendInt(dst, int64(v), 10), nil
+	case int8:
+		return strconv.AppendInt(dst, int64(v), 10), nil
+	case int16:
+		return strconv.AppendInt(dst, int64(v), 10), nil
+	case int32:
+		return strconv.AppendInt(dst, int64(v), 10), nil
+	case int64:
+		return strconv.AppendInt(dst, v, 10), nil
+	case uint:
+		return strconv.AppendUint(dst, uint64(v), 10), nil
+	case uint8:
+		return strconv.AppendUint(dst, uint64(v), 10), nil
+	case uint16:
+		return strconv.AppendUint(dst, uint64(v), 10), nil
+	case uint32:
+		return strconv.AppendUint(dst, uint64(v), 10), nil
+	case uint64:
+		return strconv.AppendUint(dst, v, 10), nil
+	case float32:
+		return appendJsonFloat(dst, float64(v), 32)
+	case float64:
+		return appendJsonFloat(dst, v, 64)
+	case json.RawMessage:
+		return appendRawJsonValue(dst, v)
+	}
+	jsonBytes, err := marshalValue(value)
+	return append(dst, jsonBytes...), err
+}
+
+// Append the json encoding of the float; the formatting is consistent with encoding/json.
+func appendJsonFloat(dst []byte, f float64, bits int) ([]byte, error) {
+	if err := checkFiniteFloat(f, bits); err != nil {
+		return append(dst, marshalPlaceholder(err)...), err
+	}
+	var format byte = 'f'
+	if abs := math.Abs(f); abs != 0 {
+		if bits == 64 && (abs < 1e-6 || abs >= 1e21) || bits == 32 && (float32(abs) < 1e-6 || float32(abs) >= 1e21) {
+			format = 'e'
+		}
+	}
+	dst = strconv.AppendFloat(dst, f, format, -1, bits)
+	if format == 'e' {
+		// Clean up e-09 to e-9
+		var n int = len(dst)
+		if n >= 4 && dst[n - 4] == 'e' && dst[n - 3] == '-' && dst[n - 2] == '0' {
+			dst[n - 2] = dst[n - 1]
+			dst = dst[:n - 1]
+		}
+	}
+	return dst, nil
+}
+
+// Marshal the value; a value failing to marshal (or panicking while marshaling) is replaced with a placeholder
+// describing the failure so that the failure is isolated to the value. The failure, if any, is also returned.
+func marshalValue(value interface{}) (jsonBytes []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+			jsonBytes = marshalPlaceholder(err)
+		}
+	}()
+	if jsonBytes, err = json.Marshal(value); err != nil {
+		jsonBytes = marshalPlaceholder(err)
+	}
+	return
+}
+
+// Whether the bytes are a valid json value.
+func isValidJson(data []byte) bool {
+	return json.Compact(&bytes.Buffer{}, data) == nil
+}
+
+// Marshal a placeholder describing a failure (e.g. "<error: json: unsupported value: NaN>").
+func marshalPlaceholder(failure error) []byte {
+	return appendJsonString(nil, placeholder(failure))
+}
+
+// A placeholder describing a failure.
+func placeholder(failure error) string {
+	return "<error: " + failure.Error() + ">"
+}
@@ -0,0 +1,41 @@
+//go:build go1.18
+// +build go1.18
+
+/*
+Copyright 2016 Ville Koskela
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package gosteno
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func FuzzAppendJsonString(f *testing.F) {
+	f.Add("foo")
+	f.Add("<\"\\\u2028\xff>")
+	f.Fuzz(func(t *testing.T, s string) {
+		expected, _ := json.Marshal(s)
+		var expectedString, actualString string
+		actual := appendJsonString(nil, s)
+		if err := json.Unmarshal(actual, &actualString); err != nil {
+			t.Fatalf("Append of %q is not valid json %s", s, actual)
+		}
+		json.Unmarshal(expected, &expectedString)
+		if actualString != expectedString {
+			t.Fatalf("Append of %q expected %s but was %s", s, expected, actual)
+		}
+	})
+}
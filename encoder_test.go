@@ -0,0 +1,63 @@
+/*
+Copyright 2016 Ville Koskela
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package gosteno
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestAppendJsonValue(t *testing.T) {
+	t.Parallel()
+	var values []interface{} = []interface{}{
+		nil,
+		"",
+		"foo \"bar\" \\ <a href=\"&\"> \n\r\t\x00\x1f \u2028\u2029 \xff\xfe \u2603",
+		true,
+		false,
+		int(-1), int8(-8), int16(-16), int32(-32), int64(math.MinInt64),
+		uint(1), uint8(8), uint16(16), uint32(32), uint64(math.MaxUint64),
+		float32(3.14), float32(1e-7), float32(1e21),
+		float64(0), float64(-0.5), float64(3.14), float64(1e-7), float64(123456789e20), float64(1e21), float64(5e-324),
+		[]int{1, 2},
+		map[string]interface{}{"a": "A"},
+		createWidget("TestAppendJsonValue"),
+	}
+	for _, value := range values {
+		expected, _ := json.Marshal(value)
+		actual, err := appendJsonValue(nil, value)
+		if err != nil {
+			t.Errorf("Append of %v failed because %v", value, err)
+		} else if string(actual) != string(expected) {
+			t.Errorf("Append of %v expected %s but was %s", value, expected, actual)
+		}
+	}
+}
+
+func TestAppendJsonValueUnsupported(t *testing.T) {
+	t.Parallel()
+	for _, value := range []interface{}{math.NaN(), math.Inf(1), float32(math.Inf(-1)), make(chan int)} {
+		actual, err := appendJsonValue(nil, value)
+		if err == nil {
+			t.Errorf("Append of %v did not fail", value)
+		}
+		var placeholder string
+		if json.Unmarshal(actual, &placeholder) != nil || placeholder != "<error: " + err.Error() + ">" {
+			t.Errorf("Append of %v is not a placeholder %s", value, actual)
+		}
+	}
+}
@@ -0,0 +1,496 @@
+/*
+Copyright 2016 Ville Koskela
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package gosteno
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math"
+	"strconv"
+	"sync"
+)
+
+var (
+	// The member names of the Steno document.
+	keyTime = newDocumentKey("time")
+	keyName = newDocumentKey("name")
+	keyLevel = newDocumentKey("level")
+	keyData = newDocumentKey("data")
+	keyContext = newDocumentKey("context")
+	keyException = newDocumentKey("exception")
+	keyId = newDocumentKey("id")
+	keyVersion = newDocumentKey("version")
+	keyMessage = newDocumentKey("message")
+	keyHost = newDocumentKey("host")
+	keyProcessId = newDocumentKey("processId")
+	keyLogger = newDocumentKey("logger")
+	keyThreadId = newDocumentKey("threadId")
+	keyFile = newDocumentKey("file")
+	keyLine = newDocumentKey("line")
+	keyMethod = newDocumentKey("method")
+	keyNamespace = newDocumentKey("namespace")
+	keyType = newDocumentKey("type")
+	keyBacktrace = newDocumentKey("backtrace")
+	keyCauses = newDocumentKey("causes")
+
+	// Pool of writers of events.
+	eventWriterPool = sync.Pool{
+		New: func() interface{} {
+			return &eventWriter{}
+		},
+	}
+)
+
+// The output format of an eventWriter.
+type eventFormat int
+
+const (
+	eventFormatJson eventFormat = iota
+	eventFormatBinary
+	eventFormatLogfmt
+)
+
+// Writer of an event in an output format. The Formatter walks the event once writing it through the writer such that
+// its options apply identically to each format. Objects and arrays are written between begin and end calls and each
+// member of an object is preceded by its name; the writer tracks the nesting itself (e.g. to separate or to count the
+// members).
+type eventWriter struct {
+	format eventFormat
+	codec binaryCodec
+	b []byte
+	frames []writerFrame
+	// The key of the next logfmt pair.
+	key []byte
+	frameBuffer [8]writerFrame
+	scratchBuffer [64]byte
+}
+
+// A member name of the Steno document with its json encoding precomputed.
+type documentKey struct {
+	name string
+	json string
+}
+
+func newDocumentKey(name string) documentKey {
+	return documentKey{name: name, json: string(appendJsonKey(nil, name))}
+}
+
+// An object or array being written; the first frame is the root containing the event.
+type writerFrame struct {
+	// The offset at which the content begins (or for logfmt the length of the key prefix of the members).
+	start int
+	// The number of members or elements written.
+	count int
+	array bool
+}
+
+// A position of a writer.
+type writerMark struct {
+	offset int
+	depth int
+	count int
+	keyLength int
+}
+
+// Return a pooled writer appending to the buffer; the codec is required by the binary format only.
+func getEventWriter(format eventFormat, codec binaryCodec, b []byte) *eventWriter {
+	var w *eventWriter = eventWriterPool.Get().(*eventWriter)
+	w.init(format, codec, b)
+	return w
+}
+
+// Release the writer returning the buffer appended to.
+func putEventWriter(w *eventWriter) []byte {
+	var b []byte = w.b
+	w.b = nil
+	w.codec = nil
+	eventWriterPool.Put(w)
+	return b
+}
+
+// Initialize the writer appending to the buffer.
+func (w *eventWriter) init(format eventFormat, codec binaryCodec, b []byte) {
+	w.format = format
+	w.codec = codec
+	w.b = b
+	w.frames = append(w.frameBuffer[:0], writerFrame{})
+	w.key = w.key[:0]
+}
+
+// The number of bytes written; used to enforce the maximum event size.
+func (w *eventWriter) size() int {
+	return len(w.b)
+}
+
+// Return the current position; rewinding to it discards everything written since.
+func (w *eventWriter) mark() writerMark {
+	return writerMark{offset: len(w.b), depth: len(w.frames), count: w.top().count, keyLength: len(w.key)}
+}
+
+func (w *eventWriter) rewind(m writerMark) {
+	w.b = w.b[:m.offset]
+	w.frames = w.frames[:m.depth]
+	w.top().count = m.count
+	w.key = w.key[:m.keyLength]
+}
+
+// A buffer for rendering a value before writing it (e.g. the time); it is reused by the next caller.
+func (w *eventWriter) scratch() []byte {
+	return w.scratchBuffer[:0]
+}
+
+func (w *eventWriter) top() *writerFrame {
+	return &w.frames[len(w.frames) - 1]
+}
+
+// Begin a value as the next member or element of the current object or array.
+func (w *eventWriter) beginValue() {
+	var frame *writerFrame = w.top()
+	switch w.format {
+	case eventFormatJson:
+		if frame.array && frame.count > 0 {
+			w.b = append(w.b, ',')
+		}
+	case eventFormatLogfmt:
+		if frame.array {
+			w.key = strconv.AppendInt(w.key[:frame.start], int64(frame.count), 10)
+		}
+	}
+	frame.count++
+}
+
+func (w *eventWriter) writeName(name string) {
+	switch w.format {
+	case eventFormatBinary:
+		w.b = append(w.codec.appendStringHeader(w.b, len(name)), name...)
+	case eventFormatLogfmt:
+		w.key = appendLogfmtKey(w.key[:w.top().start], name)
+	default:
+		if w.top().count > 0 {
+			w.b = append(w.b, ',')
+		}
+		w.b = appendJsonKey(w.b, name)
+	}
+}
+
+func (w *eventWriter) writeKey(key documentKey) {
+	if w.format != eventFormatJson {
+		w.writeName(key.name)
+		return
+	}
+	if w.top().count > 0 {
+		w.b = append(w.b, ',')
+	}
+	w.b = append(w.b, key.json...)
+}
+
+func (w *eventWriter) beginObject() {
+	w.beginContainer(false)
+}
+
+func (w *eventWriter) endObject() {
+	w.endContainer()
+}
+
+func (w *eventWriter) beginArray() {
+	w.beginContainer(true)
+}
+
+func (w *eventWriter) endArray() {
+	w.endContainer()
+}
+
+func (w *eventWriter) beginContainer(array bool) {
+	w.beginValue()
+	var start int = len(w.b)
+	switch w.format {
+	case eventFormatBinary:
+		w.b = append(w.b, make([]byte, containerHeaderReserve)...)
+	case eventFormatLogfmt:
+		// The members of the event itself are not prefixed
+		if len(w.frames) > 1 {
+			w.key = append(w.key, '.')
+		}
+		start = len(w.key)
+	default:
+		if array {
+			w.b = append(w.b, '[')
+		} else {
+			w.b = append(w.b, '{')
+		}
+		start = len(w.b)
+	}
+	w.frames = append(w.frames, writerFrame{start: start, array: array})
+}
+
+func (w *eventWriter) endContainer() {
+	var frame writerFrame = w.frames[len(w.frames) - 1]
+	w.frames = w.frames[:len(w.frames) - 1]
+	switch w.format {
+	case eventFormatBinary:
+		w.b = compactContainerHeader(w.b, w.codec, frame)
+	case eventFormatLogfmt:
+		if frame.count == 0 && frame.start > 0 {
+			w.b = appendLogfmtEmpty(w.b, w.key[:frame.start - 1], frame.array)
+		}
+	default:
+		if frame.array {
+			w.b = append(w.b, ']')
+		} else {
+			w.b = append(w.b, '}')
+		}
+	}
+}
+
+func (w *eventWriter) writeNull() {
+	w.beginValue()
+	switch w.format {
+	case eventFormatBinary:
+		w.b = w.codec.appendNil(w.b)
+	case eventFormatLogfmt:
+		w.b = appendLogfmtPair(w.b, w.key, "null")
+	default:
+		w.b = append(w.b, "null"...)
+	}
+}
+
+func (w *eventWriter) writeBool(v bool) {
+	w.beginValue()
+	switch w.format {
+	case eventFormatBinary:
+		w.b = w.codec.appendBool(w.b, v)
+	case eventFormatLogfmt:
+		w.b = strconv.AppendBool(appendLogfmtPair(w.b, w.key, ""), v)
+	default:
+		w.b = strconv.AppendBool(w.b, v)
+	}
+}
+
+func (w *eventWriter) writeInt(v int64) {
+	w.beginValue()
+	switch w.format {
+	case eventFormatBinary:
+		w.b = w.codec.appendInt(w.b, v)
+	case eventFormatLogfmt:
+		w.b = strconv.AppendInt(appendLogfmtPair(w.b, w.key, ""), v, 10)
+	default:
+		w.b = strconv.AppendInt(w.b, v, 10)
+	}
+}
+
+func (w *eventWriter) writeUint(v uint64) {
+	w.beginValue()
+	switch w.format {
+	case eventFormatBinary:
+		w.b = w.codec.appendUint(w.b, v)
+	case eventFormatLogfmt:
+		w.b = strconv.AppendUint(appendLogfmtPair(w.b, w.key, ""), v, 10)
+	default:
+		w.b = strconv.AppendUint(w.b, v, 10)
+	}
+}
+
+// Write the float; a non-finite float cannot be represented and is replaced by a placeholder and the failure returned.
+func (w *eventWriter) writeFloat(v float64, bits int) error {
+	if err := checkFiniteFloat(v, bits); err != nil {
+		w.writeString(placeholder(err))
+		return err
+	}
+	w.beginValue()
+	switch w.format {
+	case eventFormatBinary:
+		if bits == 32 {
+			w.b = w.codec.appendFloat32(w.b, float32(v))
+		} else {
+			w.b = w.codec.appendFloat(w.b, v)
+		}
+	case eventFormatLogfmt:
+		w.b, _ = appendJsonFloat(appendLogfmtPair(w.b, w.key, ""), v, bits)
+	default:
+		w.b, _ = appendJsonFloat(w.b, v, bits)
+	}
+	return nil
+}
+
+func (w *eventWriter) writeString(v string) {
+	w.beginValue()
+	switch w.format {
+	case eventFormatBinary:
+		w.b = append(w.codec.appendStringHeader(w.b, len(v)), v...)
+	case eventFormatLogfmt:
+		w.b = appendLogfmtString(appendLogfmtPair(w.b, w.key, ""), v)
+	default:
+		w.b = appendJsonString(w.b, v)
+	}
+}
+
+func (w *eventWriter) writeStringBytes(v []byte) {
+	if w.format == eventFormatJson && !needsJsonEscape(v) {
+		w.beginValue()
+		w.b = append(w.b, '"')
+		w.b = append(w.b, v...)
+		w.b = append(w.b, '"')
+		return
+	}
+	w.writeString(string(v))
+}
+
+// Write the valid json number literal; the binary format encodes it as an integer if it is one.
+func (w *eventWriter) writeNumber(v string) {
+	if w.format == eventFormatBinary {
+		if i, err := strconv.ParseInt(v, 10, 64); err == nil {
+			w.writeInt(i)
+		} else if u, err := strconv.ParseUint(v, 10, 64); err == nil {
+			w.writeUint(u)
+		} else {
+			f, _ := strconv.ParseFloat(v, 64)
+			w.writeFloat(f, 64)
+		}
+		return
+	}
+	w.beginValue()
+	if w.format == eventFormatLogfmt {
+		w.b = appendLogfmtPair(w.b, w.key, v)
+	} else {
+		w.b = append(w.b, v...)
+	}
+}
+
+// Write the json value; an invalid value is replaced by a placeholder and the failure returned.
+func (w *eventWriter) writeJson(v json.RawMessage) error {
+	if w.format != eventFormatJson {
+		return w.writeJsonTokens(v)
+	}
+	w.beginValue()
+	var err error
+	w.b, err = appendRawJsonValue(w.b, v)
+	return err
+}
+
+// Write the value consistent with encoding/json; a value failing to encode is isolated as a placeholder and the
+// failure returned.
+func (w *eventWriter) writeValue(v interface{}) error {
+	if w.format != eventFormatJson {
+		return writeRedactedValue(w, v, valueLimits{}, nil, nil)
+	}
+	w.beginValue()
+	var err error
+	w.b, err = appendJsonValue(w.b, v)
+	return err
+}
+
+// Write the json value as its tokens for formats other than json; numbers are written as their literals and object
+// members in their order.
+func (w *eventWriter) writeJsonTokens(value json.RawMessage) error {
+	if value == nil {
+		w.writeNull()
+		return nil
+	}
+	if err := json.Compact(&bytes.Buffer{}, value); err != nil {
+		err = errors.New("invalid json: " + err.Error())
+		w.writeString(placeholder(err))
+		return err
+	}
+	var decoder *json.Decoder = json.NewDecoder(bytes.NewReader(value))
+	decoder.UseNumber()
+	w.writeDecodedTokens(decoder)
+	return nil
+}
+
+// Write the next value of the decoder of valid json.
+func (w *eventWriter) writeDecodedTokens(decoder *json.Decoder) {
+	token, _ := decoder.Token()
+	switch token := token.(type) {
+	case json.Delim:
+		if token == '{' {
+			w.beginObject()
+			for decoder.More() {
+				name, _ := decoder.Token()
+				w.writeName(name.(string))
+				w.writeDecodedTokens(decoder)
+			}
+			w.endObject()
+		} else {
+			w.beginArray()
+			for decoder.More() {
+				w.writeDecodedTokens(decoder)
+			}
+			w.endArray()
+		}
+		decoder.Token()
+	case string:
+		w.writeString(token)
+	case json.Number:
+		w.writeNumber(token.String())
+	case bool:
+		w.writeBool(token)
+	case nil:
+		w.writeNull()
+	}
+}
+
+// Write the value if it is of a common scalar type returning whether it was written and the failure, if any.
+func writeScalarValue(w *eventWriter, value interface{}) (bool, error) {
+	switch v := value.(type) {
+	case nil:
+		w.writeNull()
+	case string:
+		w.writeString(v)
+	case bool:
+		w.writeBool(v)
+	case int:
+		w.writeInt(int64(v))
+	case int8:
+		w.writeInt(int64(v))
+	case int16:
+		w.writeInt(int64(v))
+	case int32:
+		w.writeInt(int64(v))
+	case int64:
+		w.writeInt(v)
+	case uint:
+		w.writeUint(uint64(v))
+	case uint8:
+		w.writeUint(uint64(v))
+	case uint16:
+		w.writeUint(uint64(v))
+	case uint32:
+		w.writeUint(uint64(v))
+	case uint64:
+		w.writeUint(v)
+	case float32:
+		return true, w.writeFloat(float64(v), 32)
+	case float64:
+		return true, w.writeFloat(v, 64)
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
+// Write the string truncating it to the maximum length; zero is unlimited.
+func writeLimitedString(w *eventWriter, s string, maxLength int) {
+	w.writeString(truncateString(s, maxLength))
+}
+
+// Return the failure of a float which cannot be represented in json; nil if it is finite.
+func checkFiniteFloat(f float64, bits int) error {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return &json.UnsupportedValueError{Str: strconv.FormatFloat(f, 'g', -1, bits)}
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+/*
+Copyright 2016 Ville Koskela
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package gosteno
+
+import (
+	"fmt"
+	"reflect"
+	"github.com/Sirupsen/logrus"
+)
+
+const (
+	// The maximum depth of nested causes rendered for an exception.
+	maxCauseDepth = 16
+
+	// The key of the placeholder replacing the exception data of an error panicking.
+	exceptionDataErrorKey = "_error"
+)
+
+var (
+	// Cache of exception type names by error type.
+	errorTypeNames cacheMap
+)
+
+// TypedError is an optional interface errors may implement to supply their own exception type.
+type TypedError interface {
+
+	// The exception type name.
+	StenoErrorType() string
+}
+
+// DataError is an optional interface errors may implement to supply structured data for the exception.
+type DataError interface {
+
+	// The exception data.
+	StenoErrorData() map[string]interface{}
+}
+
+// Return the errors directly wrapped by the specified error; supports both single (e.g. fmt.Errorf with %w) and
+// multiple (e.g. errors.Join) wrapped errors.
+func unwrapCauses(err error) []error {
+	switch err := err.(type) {
+	case interface{ Unwrap() error }:
+		if cause := err.Unwrap(); cause != nil {
+			return []error{cause}
+		}
+	case interface{ Unwrap() []error }:
+		var causes []error = make([]error, 0, len(err.Unwrap()))
+		for _, cause := range err.Unwrap() {
+			if cause != nil {
+				causes = append(causes, cause)
+			}
+		}
+		return causes
+	}
+	return nil
+}
+
+// Write the exception data block containing the data carried by and the causes of the specified error, if any.
+func (sf *Formatter) writeExceptionData(w *eventWriter, e *logrus.Entry, entryError error, depth int) {
+	var data map[string]interface{}
+	var causes []error
+	if dataError, ok := entryError.(DataError); ok {
+		var err error
+		if data, err = getErrorData(dataError); err != nil {
+			sf.reportError(e, "exception", "", err)
+			data = map[string]interface{}{exceptionDataErrorKey: placeholder(err)}
+		}
+	}
+	if sf.injectExceptionCauses && depth < maxCauseDepth {
+		causes = unwrapCauses(entryError)
+	}
+	if len(data) == 0 && len(causes) == 0 {
+		return
+	}
+	w.writeKey(keyData)
+	w.beginObject()
+	for key, value := range data {
+		// Favor causes derived from the error over any data with the same key
+		if key == "causes" && len(causes) > 0 {
+			continue
+		}
+		sf.writeMember(w, e, "exception", key, value)
+	}
+	if len(causes) > 0 {
+		w.writeKey(keyCauses)
+		w.beginArray()
+		for _, cause := range causes {
+			sf.writeCause(w, e, cause, depth + 1)
+		}
+		w.endArray()
+	}
+	w.endObject()
+}
+
+// Write a cause as exception content including its own causes.
+func (sf *Formatter) writeCause(w *eventWriter, e *logrus.Entry, cause error, depth int) {
+	w.beginObject()
+	w.writeKey(keyType)
+	w.writeString(getErrorType(cause))
+	w.writeKey(keyMessage)
+	w.writeString(sf.getErrorMessage(e, cause))
+	sf.writeExceptionData(w, e, cause, depth)
+	w.endObject()
+}
+
+// Return the message of the error; an error panicking (e.g. a nil pointer receiver) is reported as a failure and
+// replaced by a placeholder.
+func (sf *Formatter) getErrorMessage(e *logrus.Entry, err error) string {
+	message, failure := callErrorMessage(err)
+	if failure != nil {
+		sf.reportError(e, "exception", "", failure)
+		return placeholder(failure)
+	}
+	return message
+}
+
+// Return the message of the error; an error panicking is returned as a failure.
+func callErrorMessage(err error) (message string, failure error) {
+	defer func() {
+		if r := recover(); r != nil {
+			message = ""
+			failure = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return err.Error(), nil
+}
+
+// Return the exception data of the error; an error panicking is reported as a failure.
+func getErrorData(dataError DataError) (data map[string]interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			data = nil
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return dataError.StenoErrorData(), nil
+}
+
+// Return the exception type of the error; either as supplied by the error or the package qualified name of its dynamic
+// type (e.g. *github.com/acme/billing.InvoiceError).
+func getErrorType(err error) string {
+	if typedError, ok := err.(TypedError); ok {
+		if name := getTypedErrorType(typedError); name != "" {
+			return name
+		}
+	}
+	var errorType reflect.Type = reflect.TypeOf(err)
+	if name, ok := errorTypeNames.load(errorType); ok {
+		return name.(string)
+	}
+	var name string = getTypeName(errorType)
+	errorTypeNames.store(errorType, name)
+	return name
+}
+
+// Return the exception type supplied by the error; an error panicking is replaced by a placeholder.
+func getTypedErrorType(typedError TypedError) (name string) {
+	defer func() {
+		if r := recover(); r != nil {
+			name = "<error: panic: " + fmt.Sprint(r) + ">"
+		}
+	}()
+	return typedError.StenoErrorType()
+}
+
+func getTypeName(t reflect.Type) string {
+	if t.Kind() == reflect.Ptr {
+		return "*" + getTypeName(t.Elem())
+	}
+	if t.Name() == "" || t.PkgPath() == "" {
+		return t.String()
+	}
+	return t.PkgPath() + "." + t.Name()
+}
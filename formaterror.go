@@ -0,0 +1,66 @@
+/*
+Copyright 2016 Ville Koskela
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package gosteno
+
+import (
+	"sync/atomic"
+	"github.com/Sirupsen/logrus"
+)
+
+// ErrorHandler is invoked with internal failures encountered while formatting an event. The error is a *FormatError.
+type ErrorHandler func(error, *logrus.Entry)
+
+// FormatError describes an internal failure encountered while formatting an event.
+type FormatError struct {
+
+	// The event name.
+	Event string
+
+	// The block of the event containing the failure (e.g. data, context or exception).
+	Block string
+
+	// The key of the value that failed; empty if the failure is not specific to a value.
+	Key string
+
+	// The underlying failure.
+	Err error
+}
+
+func (fe *FormatError) Error() string {
+	if fe.Key == "" {
+		return "gosteno: failed to format " + fe.Block + " of event " + fe.Event + ": " + fe.Err.Error()
+	}
+	return "gosteno: failed to format " + fe.Block + " key " + fe.Key + " of event " + fe.Event + ": " + fe.Err.Error()
+}
+
+func (fe *FormatError) Unwrap() error {
+	return fe.Err
+}
+
+// Count the failure and report it to the error handler, if any.
+func (sf *Formatter) reportError(e *logrus.Entry, block string, key string, err error) {
+	atomic.AddUint64(&sf.errorCount, 1)
+	if sf.errorHandler != nil {
+		sf.errorHandler(
+			&FormatError{
+				Event: sf.getEventName(e, sf.logEventName),
+				Block: block,
+				Key: key,
+				Err: err,
+			},
+			e)
+	}
+}
@@ -16,21 +16,105 @@ limitations under the License.
 package gosteno
 
 import (
-	"bytes"
 	"encoding/json"
+	"fmt"
 	"os"
+	"path/filepath"
+	"reflect"
 	"strconv"
+	"sync/atomic"
 	"time"
-	"github.com/pborman/uuid"
 	"github.com/Sirupsen/logrus"
 )
 
 const (
 	globalDefaultEventName = "log"
+	defaultRelocatedContextName = "context"
+)
+
+// TimeFormat specifies the rendering of the event time.
+type TimeFormat int
+
+const (
+	// RFC 3339 with up to nanosecond precision omitting trailing zeros (e.g. 2016-01-02T03:04:05.06Z). This is the
+	// default.
+	TimeFormatRFC3339Nano TimeFormat = iota
+
+	// RFC 3339 with fixed millisecond precision (e.g. 2016-01-02T03:04:05.060Z).
+	TimeFormatRFC3339Millis
+
+	// RFC 3339 with fixed microsecond precision (e.g. 2016-01-02T03:04:05.060000Z).
+	TimeFormatRFC3339Micros
+
+	// RFC 3339 with fixed nanosecond precision (e.g. 2016-01-02T03:04:05.060000000Z).
+	TimeFormatRFC3339NanosFixed
+
+	// Milliseconds since the epoch as a number (e.g. 1451703845060). Note that this does not conform to the Steno schema.
+	TimeFormatEpochMillis
+)
+
+// ContextRelocation specifies where context keys not permitted by the Steno schema are relocated in strict context
+// mode.
+type ContextRelocation int
+
+const (
+	// Into an object in data named by the relocated context name (e.g. "data":{"context":{"requestId":"abc"}}); an empty
+	// name names the object "context". This is the default.
+	ContextRelocationObject ContextRelocation = iota
+
+	// Into data with the key prefixed by the relocated context name and a period (e.g.
+	// "data":{"context.requestId":"abc"}); an empty name relocates the keys as is.
+	ContextRelocationPrefix
+)
+
+// The trace level of newer versions of logrus (e.g. logrus.TraceLevel) which sorts after debug.
+const traceLevel logrus.Level = logrus.DebugLevel + 1
+
+var (
+	// The level names permitted by the Steno schema.
+	stenoLevelNames = map[string]bool{
+		"debug": true,
+		"info": true,
+		"warn": true,
+		"crit": true,
+		"fatal": true,
+		"unknown": true,
+	}
+
+	// The context keys permitted by the Steno schema; the values must be strings.
+	stenoContextKeys = map[string]bool{
+		"file": true,
+		"line": true,
+		"method": true,
+		"class": true,
+		"namespace": true,
+		"threadId": true,
+		"processId": true,
+		"host": true,
+	}
+
+	// The default level names of events by logrus level.
+	defaultLevelNames = map[logrus.Level]string{
+		traceLevel: "debug",
+		logrus.DebugLevel: "debug",
+		logrus.InfoLevel: "info",
+		logrus.WarnLevel: "warn",
+		logrus.ErrorLevel: "crit",
+		logrus.FatalLevel: "fatal",
+		logrus.PanicLevel: "fatal",
+	}
+
+	timeLayouts = map[TimeFormat]string{
+		TimeFormatRFC3339Nano: time.RFC3339Nano,
+		TimeFormatRFC3339Millis: "2006-01-02T15:04:05.000Z07:00",
+		TimeFormatRFC3339Micros: "2006-01-02T15:04:05.000000Z07:00",
+		TimeFormatRFC3339NanosFixed: "2006-01-02T15:04:05.000000000Z07:00",
+	}
 )
 
 var (
 	newLine = []byte("\n")
+	defaultIdGenerator IdGenerator = NewRandomIdGenerator()
 	hostname = "<UNKNOWN>"
 	processId = "<UNKNOWN>"
 )
@@ -48,91 +132,119 @@ func init() {
 	processId = strconv.Itoa(os.Getpid())
 }
 
+// Formatter renders logrus entries as Steno JSON. Options should be configured before the formatter is used.
 type Formatter struct {
+	// First such that it is 64-bit aligned for atomic access on 32-bit platforms
+	errorCount uint64
 	logEventName string
+	timeFormat TimeFormat
+	timeLocation *time.Location
+	levelNames map[logrus.Level]string
+	strictLevelNames bool
 	injectContextHost bool
 	injectContextProcess bool
 	injectContextLogger bool
+	injectContextThread bool
+	injectContextFile bool
+	injectContextLine bool
+	injectContextMethod bool
+	injectContextNamespace bool
+	callerSkipFrames int
+	injectBacktrace map[logrus.Level]bool
+	backtraceDepth int
+	backtraceFilters []string
+	injectExceptionCauses bool
+	idGenerator IdGenerator
+	errorHandler ErrorHandler
+	encoders *encoderRegistry
+	maxDepth int
+	maxElements int
+	maxStringLength int
+	maxEventSize int
+	redactor *Redactor
+	strictContext bool
+	contextRelocation ContextRelocation
+	relocatedContextName string
+	loggerNameAbbreviator *loggerNameAbbreviator
 }
 
 func NewFormatter() *Formatter {
 	return &Formatter{
 		logEventName: globalDefaultEventName,
+		timeFormat: TimeFormatRFC3339Nano,
+		timeLocation: time.UTC,
+		levelNames: copyLevelNames(defaultLevelNames),
+		strictLevelNames: true,
 		injectContextHost: true,
 		injectContextProcess: true,
 		injectContextLogger: false,
+		injectContextThread: false,
+		injectContextFile: false,
+		injectContextLine: false,
+		injectContextMethod: false,
+		injectContextNamespace: false,
+		callerSkipFrames: 0,
+		injectBacktrace: map[logrus.Level]bool{
+			logrus.ErrorLevel: true,
+			logrus.FatalLevel: true,
+			logrus.PanicLevel: true,
+		},
+		backtraceDepth: defaultBacktraceDepth,
+		backtraceFilters: defaultBacktraceFilters,
+		injectExceptionCauses: true,
+		idGenerator: defaultIdGenerator,
+		strictContext: false,
+		contextRelocation: ContextRelocationObject,
+		relocatedContextName: defaultRelocatedContextName,
 	}
 }
 
-func (sf *Formatter) Format(e *logrus.Entry) (result []byte, err error) {
-	var initialStenoBuffer []byte = make([]byte, 0, 512)
-	var initialUserBuffer []byte = make([]byte, 0, 256)
-	var stenoBuffer *bytes.Buffer = bytes.NewBuffer(initialStenoBuffer)
-	var userBuffer *bytes.Buffer = bytes.NewBuffer(initialUserBuffer)
-	var value []byte
-
-	// Begin steno wrapper
-	if _, err = stenoBuffer.WriteString("{"); err != nil {
-		return
-	}
-	if err = writeKeyStringValue(stenoBuffer, "time", sf.getTime(e)); err != nil {
-		return
-	}
-	if err = writeKeyStringValue(stenoBuffer, "name", sf.getEventName(e, sf.logEventName)); err != nil {
-		return
-	}
-	if err = writeKeyStringValue(stenoBuffer, "level", sf.getLevel(e)); err != nil {
-		return
-	}
+func (sf *Formatter) Format(e *logrus.Entry) ([]byte, error) {
+	var buffer *[]byte = getBuffer()
+	var w *eventWriter = getEventWriter(eventFormatJson, nil, *buffer)
+	sf.writeEvent(w, e)
+	var b []byte = append(putEventWriter(w), newLine...)
+	return completeFormat(e, buffer, b), nil
+}
 
-	// Encode user data; handle errors more gracefully by encoding them into the buffer if possible
-	if value, err = sf.getData(e); err != nil {
-		if err = writeError(stenoBuffer, err); err != nil {
-			return
-		}
-	} else if err = writeKeyJsonValue(userBuffer, "data", value); err != nil {
-		if err = writeError(stenoBuffer, err); err != nil {
-			return
-		}
+// Return the formatted event and release the pooled buffer. Logrus provides a pooled buffer for the result when
+// logging; otherwise the result must be copied.
+func completeFormat(e *logrus.Entry, buffer *[]byte, b []byte) (result []byte) {
+	if e.Buffer != nil {
+		e.Buffer.Write(b)
+		result = e.Buffer.Bytes()
 	} else {
-		if value, err = sf.getContext(e); err != nil {
-			if err = writeError(stenoBuffer, err); err != nil {
-				return
-			}
-		} else if err = writeKeyJsonValue(userBuffer, "context", value); err != nil {
-			if err = writeError(stenoBuffer, err); err != nil {
-				return
-			}
-		} else {
-			if value, err = sf.getError(e); err != nil {
-				if err = writeError(userBuffer, err); err != nil {
-					return
-				}
-			} else if value != nil {
-				if err = writeKeyJsonValue(userBuffer, "exception", value); err != nil {
-					if err = writeError(stenoBuffer, err); err != nil {
-						return
-					}
-				} else if _, err = stenoBuffer.Write(userBuffer.Bytes()); err != nil {
-					return
-				}
-			} else if _, err = stenoBuffer.Write(userBuffer.Bytes()); err != nil {
-				return
-			}
-		}
+		result = make([]byte, len(b))
+		copy(result, b)
 	}
+	*buffer = b
+	putBuffer(buffer)
+	return result
+}
+
+// Write the event as a Steno document; values failing to encode are isolated as placeholders.
+func (sf *Formatter) writeEvent(w *eventWriter, e *logrus.Entry) {
+	// Begin steno wrapper
+	w.beginObject()
+	w.writeKey(keyTime)
+	sf.writeTime(w, e)
+	w.writeKey(keyName)
+	w.writeString(sf.getEventName(e, sf.logEventName))
+	w.writeKey(keyLevel)
+	w.writeString(sf.getLevel(e))
+
+	// Encode user data, context and exception
+	w.writeKey(keyData)
+	sf.writeData(w, e)
+	w.writeKey(keyContext)
+	sf.writeContext(w, e)
+	sf.writeException(w, e)
 
 	// Complete steno wrapper
-	if err = writeKeyStringValue(stenoBuffer, "id", uuid.New()); err != nil {
-		return
-	}
-	if err = writeKeyStringValue(stenoBuffer, "version", "0"); err != nil {
-		return
-	}
-	stenoBuffer.Write(newLine);
-	result = stenoBuffer.Bytes()
-	result[len(result) - len(newLine) - 1] = '}'
-	return
+	sf.writeId(w, e)
+	w.writeKey(keyVersion)
+	w.writeString("0")
+	w.endObject()
 }
 
 func (sf *Formatter) LogEventName() string {
@@ -143,6 +255,59 @@ func (sf *Formatter) SetLogEventName(v string) {
 	sf.logEventName = v
 }
 
+func (sf *Formatter) TimeFormat() TimeFormat {
+	return sf.timeFormat
+}
+
+// Set the rendering of the event time. The default is TimeFormatRFC3339Nano.
+func (sf *Formatter) SetTimeFormat(v TimeFormat) {
+	sf.timeFormat = v
+}
+
+func (sf *Formatter) TimeLocation() *time.Location {
+	return sf.timeLocation
+}
+
+// Set the time zone the event time is rendered in. The default is UTC.
+func (sf *Formatter) SetTimeLocation(v *time.Location) {
+	sf.timeLocation = v
+}
+
+// The level name of events at the specified level.
+func (sf *Formatter) LevelName(l logrus.Level) string {
+	return sf.getLevel(&logrus.Entry{Level: l})
+}
+
+// Set the level name of events at the level; in strict mode it must be a Steno level. The default maps trace to
+// "debug", error to "crit" and panic to "fatal".
+func (sf *Formatter) SetLevelName(l logrus.Level, v string) error {
+	if sf.strictLevelNames && !stenoLevelNames[v] {
+		return fmt.Errorf("gosteno: level name %q is not a steno level", v)
+	}
+	if sf.levelNames == nil {
+		sf.levelNames = copyLevelNames(defaultLevelNames)
+	}
+	sf.levelNames[l] = v
+	return nil
+}
+
+func (sf *Formatter) StrictLevelNames() bool {
+	return sf.strictLevelNames
+}
+
+// Set whether level names must be Steno levels; enabling fails if a level is mapped otherwise. The default is true.
+func (sf *Formatter) SetStrictLevelNames(v bool) error {
+	if v {
+		for l, name := range sf.levelNames {
+			if !stenoLevelNames[name] {
+				return fmt.Errorf("gosteno: level name %q of level %v is not a steno level", name, l)
+			}
+		}
+	}
+	sf.strictLevelNames = v
+	return nil
+}
+
 func (sf *Formatter) InjectContextHost() bool {
 	return sf.injectContextHost
 }
@@ -167,229 +332,728 @@ func (sf *Formatter) SetInjectContextLogger(v bool) {
 	sf.injectContextLogger = v
 }
 
+func (sf *Formatter) InjectContextThread() bool {
+	return sf.injectContextThread
+}
+
+// Set whether the thread (see Logger.WithThreadId) or else goroutine is injected into context. The default is false.
+func (sf *Formatter) SetInjectContextThread(v bool) {
+	sf.injectContextThread = v
+}
+
+func (sf *Formatter) InjectContextFile() bool {
+	return sf.injectContextFile
+}
+
+func (sf *Formatter) SetInjectContextFile(v bool) {
+	sf.injectContextFile = v
+}
+
+func (sf *Formatter) InjectContextLine() bool {
+	return sf.injectContextLine
+}
+
+func (sf *Formatter) SetInjectContextLine(v bool) {
+	sf.injectContextLine = v
+}
+
+func (sf *Formatter) InjectContextMethod() bool {
+	return sf.injectContextMethod
+}
+
+func (sf *Formatter) SetInjectContextMethod(v bool) {
+	sf.injectContextMethod = v
+}
+
+func (sf *Formatter) InjectContextNamespace() bool {
+	return sf.injectContextNamespace
+}
+
+func (sf *Formatter) SetInjectContextNamespace(v bool) {
+	sf.injectContextNamespace = v
+}
+
+func (sf *Formatter) LoggerNameLength() int {
+	if sf.loggerNameAbbreviator == nil {
+		return 0
+	}
+	return sf.loggerNameAbbreviator.targetLength
+}
+
+// Set the target length of the logger name; longer names are abbreviated (e.g. g.a.p.b.invoices.worker). The default
+// is 0 (unabbreviated).
+func (sf *Formatter) SetLoggerNameLength(v int) {
+	if v <= 0 {
+		sf.loggerNameAbbreviator = nil
+	} else {
+		sf.loggerNameAbbreviator = newLoggerNameAbbreviator(v)
+	}
+}
+
+func (sf *Formatter) CallerSkipFrames() int {
+	return sf.callerSkipFrames
+}
+
+// Set the number of frames above gosteno and logrus skipped to find the caller (e.g. a wrapper). The default is 0.
+func (sf *Formatter) SetCallerSkipFrames(v int) {
+	sf.callerSkipFrames = v
+}
+
+// Whether the backtrace is injected into the exception for events at the specified level.
+func (sf *Formatter) InjectBacktrace(l logrus.Level) bool {
+	return sf.injectBacktrace[l]
+}
+
+// Set whether the backtrace is injected at the level. The default is true for error, fatal and panic.
+func (sf *Formatter) SetInjectBacktrace(l logrus.Level, v bool) {
+	if sf.injectBacktrace == nil {
+		sf.injectBacktrace = make(map[logrus.Level]bool)
+	}
+	sf.injectBacktrace[l] = v
+}
+
+func (sf *Formatter) BacktraceDepth() int {
+	return sf.backtraceDepth
+}
+
+// Set the maximum number of frames in the backtrace. The default is 32.
+func (sf *Formatter) SetBacktraceDepth(v int) {
+	sf.backtraceDepth = v
+}
+
+func (sf *Formatter) BacktraceFilters() []string {
+	return sf.backtraceFilters
+}
+
+// Set the function name prefixes of frames to exclude from the backtrace. The default excludes gosteno and logrus.
+func (sf *Formatter) SetBacktraceFilters(v []string) {
+	sf.backtraceFilters = v
+}
+
+func (sf *Formatter) InjectExceptionCauses() bool {
+	return sf.injectExceptionCauses
+}
+
+// Set whether wrapped errors are added as nested causes to the exception data. The default is true.
+func (sf *Formatter) SetInjectExceptionCauses(v bool) {
+	sf.injectExceptionCauses = v
+}
+
+func (sf *Formatter) StrictContext() bool {
+	return sf.strictContext
+}
+
+// Set whether context keys not permitted by the Steno schema are relocated into data. The default is false.
+func (sf *Formatter) SetStrictContext(v bool) {
+	sf.strictContext = v
+}
+
+func (sf *Formatter) ContextRelocation() ContextRelocation {
+	return sf.contextRelocation
+}
+
+// Set where context keys are relocated in strict context mode. The default is ContextRelocationObject.
+func (sf *Formatter) SetContextRelocation(v ContextRelocation) {
+	sf.contextRelocation = v
+}
+
+func (sf *Formatter) RelocatedContextName() string {
+	return sf.relocatedContextName
+}
+
+// Set the object name or key prefix of relocated context; an empty object name is "context". The default is "context".
+func (sf *Formatter) SetRelocatedContextName(v string) {
+	sf.relocatedContextName = v
+}
+
+func (sf *Formatter) IdGenerator() IdGenerator {
+	return sf.idGenerator
+}
+
+// Set the generator of event identifiers (e.g. NewNoIdGenerator). The default is NewRandomIdGenerator.
+func (sf *Formatter) SetIdGenerator(v IdGenerator) {
+	sf.idGenerator = v
+}
+
+func (sf *Formatter) ErrorHandler() ErrorHandler {
+	return sf.errorHandler
+}
+
+// Set the handler of failures encountered while formatting, reported as a *FormatError. The default is nil.
+func (sf *Formatter) SetErrorHandler(v ErrorHandler) {
+	sf.errorHandler = v
+}
+
+// The number of internal failures encountered while formatting events.
+func (sf *Formatter) ErrorCount() uint64 {
+	return atomic.LoadUint64(&sf.errorCount)
+}
+
+func (sf *Formatter) MaxDepth() int {
+	return sf.maxDepth
+}
+
+// Set the maximum nesting of data, context and exception data values. The default is 0 (unlimited).
+func (sf *Formatter) SetMaxDepth(v int) {
+	sf.maxDepth = v
+}
+
+func (sf *Formatter) MaxElements() int {
+	return sf.maxElements
+}
+
+// Set the maximum number of elements of arrays and objects within values. The default is 0 (unlimited).
+func (sf *Formatter) SetMaxElements(v int) {
+	sf.maxElements = v
+}
+
+func (sf *Formatter) MaxStringLength() int {
+	return sf.maxStringLength
+}
+
+// Set the maximum length in bytes of the message and strings within values. The default is 0 (unlimited).
+func (sf *Formatter) SetMaxStringLength(v int) {
+	sf.maxStringLength = v
+}
+
+func (sf *Formatter) MaxEventSize() int {
+	return sf.maxEventSize
+}
+
+// Set the target size in bytes of the event, met by truncating the message and values. The default is 0 (unlimited).
+func (sf *Formatter) SetMaxEventSize(v int) {
+	sf.maxEventSize = v
+}
+
+func (sf *Formatter) Redactor() *Redactor {
+	return sf.redactor
+}
+
+// Set the redactor of the message, data, context and exception data. The default is nil (no redaction).
+func (sf *Formatter) SetRedactor(v *Redactor) {
+	sf.redactor = v
+}
+
+// The encoder registered for the type; nil if none.
+func (sf *Formatter) Encoder(t reflect.Type) ValueEncoder {
+	if sf.encoders == nil {
+		return nil
+	}
+	return sf.encoders.encoders[t]
+}
+
+// Register the encoder of values of the type, or implementing the interface type; nil removes it. Values without an
+// encoder are encoded with encoding/json.
+func (sf *Formatter) RegisterEncoder(t reflect.Type, encoder ValueEncoder) {
+	sf.encoders = sf.encoders.with(t, encoder)
+}
+
+func (sf *Formatter) writeId(w *eventWriter, e *logrus.Entry) {
+	var idGenerator IdGenerator = sf.idGenerator
+	if idGenerator == nil {
+		idGenerator = defaultIdGenerator
+	}
+	var id []byte = idGenerator.AppendId(w.scratch(), e)
+	if len(id) == 0 {
+		return
+	}
+	w.writeKey(keyId)
+	w.writeStringBytes(id)
+}
+
 func (sf *Formatter) getTime(e *logrus.Entry) string {
-	return e.Time.UTC().Format(time.RFC3339Nano)
+	return string(sf.appendTimeValue(nil, e))
 }
 
 func (sf *Formatter) getEventName(e *logrus.Entry, defaultName string) string {
+	if name := getEntryEvent(e); name != "" {
+		return name
+	}
+	return defaultName
+}
+
+func (sf *Formatter) getLevel(e *logrus.Entry) string {
+	var levelNames map[logrus.Level]string = sf.levelNames
+	if levelNames == nil {
+		levelNames = defaultLevelNames
+	}
+	if name, ok := levelNames[e.Level]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+func copyLevelNames(levelNames map[logrus.Level]string) map[logrus.Level]string {
+	var result map[logrus.Level]string = make(map[logrus.Level]string, len(levelNames))
+	for l, name := range levelNames {
+		result[l] = name
+	}
+	return result
+}
+
+// Return the event name of the event; empty if not specified.
+func getEntryEvent(e *logrus.Entry) string {
 	var marker interface{} = e.Data[MarkerKey]
 	switch marker := marker.(type) {
 	default:
-		return defaultName
-	case *MapsMarker:
-		var name string
-		if name = marker.ParseEvent(e); name != "" {
-			return name
+		return ""
+	case Marker:
+		return marker.ParseEvent(e)
+	}
+}
+
+// Return the data of the event and whether the event was encoded with a valid marker.
+func getEntryData(e *logrus.Entry) (map[string]interface{}, bool) {
+	var marker interface{} = e.Data[MarkerKey]
+	switch marker := marker.(type) {
+	default:
+		return e.Data, false
+	case Marker:
+		return marker.ParseData(e), true
+	}
+}
+
+// Return the data of the event as a json object if supplied by the marker (see RawMarker), the data in addition to it
+// and whether the event was encoded with a valid marker.
+func getEntryRawData(e *logrus.Entry) (json.RawMessage, map[string]interface{}, bool) {
+	if marker, ok := e.Data[MarkerKey].(RawMarker); ok {
+		raw, data := marker.ParseRawData(e)
+		return raw, data, true
+	}
+	data, hasValidMarker := getEntryData(e)
+	return nil, data, hasValidMarker
+}
+
+// Return the context of the event as a json object if supplied by the marker (see RawMarker), the context in addition
+// to it and the logger name of the event.
+func getEntryRawContext(e *logrus.Entry) (json.RawMessage, map[string]interface{}, string) {
+	if marker, ok := e.Data[MarkerKey].(RawMarker); ok {
+		raw, context := marker.ParseRawContext(e)
+		var loggerName string
+		if namedMarker, ok := marker.(Marker); ok {
+			loggerName = namedMarker.ParseLoggerName(e)
 		}
-		return defaultName
+		return raw, context, loggerName
 	}
+	context, loggerName := getEntryContext(e)
+	return nil, context, loggerName
 }
 
-func (sf *Formatter) getLevel(e *logrus.Entry) string {
-	switch e.Level {
-	case logrus.DebugLevel:
-		return "debug"
-	case logrus.InfoLevel:
-		return "info"
-	case logrus.WarnLevel:
-		return "warn"
-	case logrus.ErrorLevel:
-		return "crit"
-	case logrus.FatalLevel:
-		return "fatal"
-	case logrus.PanicLevel:
-		return "fatal"
+// Return the context and logger name of the event.
+func getEntryContext(e *logrus.Entry) (map[string]interface{}, string) {
+	var marker interface{} = e.Data[MarkerKey]
+	switch marker := marker.(type) {
+	default:
+		return nil, ""
+	case Marker:
+		return marker.ParseContext(e), marker.ParseLoggerName(e)
 	}
-	return "unknown"
 }
 
-func (sf *Formatter) getData(e *logrus.Entry) (jsonBytes []byte, err error) {
-	var data map[string]interface{}
+// Return the error of the event.
+func getEntryError(e *logrus.Entry) error {
 	var marker interface{} = e.Data[MarkerKey]
-	var hasValidMarker bool = true
 	switch marker := marker.(type) {
 	default:
-		hasValidMarker = false
-		data = e.Data
-	case *MapsMarker:
-		data = marker.ParseData(e)
+		if logrusError, ok := e.Data[logrus.ErrorKey].(error); ok {
+			return logrusError
+		}
+		return nil
+	case Marker:
+		return marker.ParseError(e)
 	}
-	var buffer bytes.Buffer
-	if _, err = buffer.WriteString("{"); err != nil {
+}
+
+// Whether the raw event data (e.g. without valid marker) key is internal to logrus or gosteno.
+func isInternalKey(key string) bool {
+	return key == logrus.ErrorKey || key == StackKey || key == ThreadKey || key == TimeKey
+}
+
+// Return the time of the event; the time supplied by a Clock when the event was logged takes precedence over the time
+// assigned by logrus.
+func getEntryTime(e *logrus.Entry) time.Time {
+	if t, ok := e.Data[TimeKey].(time.Time); ok {
+		return t
+	}
+	return e.Time
+}
+
+// The time in milliseconds since the epoch.
+func unixMillis(t time.Time) int64 {
+	return t.Unix() * 1000 + int64(t.Nanosecond()) / int64(time.Millisecond)
+}
+
+func (sf *Formatter) writeTime(w *eventWriter, e *logrus.Entry) {
+	if sf.timeFormat == TimeFormatEpochMillis {
+		w.writeInt(unixMillis(getEntryTime(e)))
 		return
 	}
+	w.writeStringBytes(sf.appendTimeValue(w.scratch(), e))
+}
+
+// Append the unquoted rendering of the event time.
+func (sf *Formatter) appendTimeValue(b []byte, e *logrus.Entry) []byte {
+	var t time.Time = getEntryTime(e)
+	if sf.timeFormat == TimeFormatEpochMillis {
+		return strconv.AppendInt(b, unixMillis(t), 10)
+	}
+	var location *time.Location = sf.timeLocation
+	if location == nil {
+		location = time.UTC
+	}
+	var layout string = timeLayouts[sf.timeFormat]
+	if layout == "" {
+		layout = time.RFC3339Nano
+	}
+	return t.In(location).AppendFormat(b, layout)
+}
+
+func (sf *Formatter) writeData(w *eventWriter, e *logrus.Entry) {
+	rawData, data, hasValidMarker := getEntryRawData(e)
+	w.beginObject()
 	if e.Message != "" {
-		if err = writeKeyStringValue(&buffer, "message", e.Message); err != nil {
-			return
+		w.writeKey(keyMessage)
+		var maxLength int = sf.maxStringLength
+		if sf.maxEventSize > 0 {
+			// Truncate the message rather than replace it when the event is too large
+			var remaining int = sf.maxEventSize - w.size()
+			if remaining < 1 {
+				remaining = 1
+			}
+			if maxLength <= 0 || remaining < maxLength {
+				maxLength = remaining
+			}
+		}
+		var message string = e.Message
+		if sf.redactor != nil {
+			message = sf.redactor.redactMessage(message)
 		}
+		writeLimitedString(w, message, maxLength)
 	}
+	sf.writeRawMembers(w, e, "data", rawData, data)
 	for key, value := range data {
 		// Favor explicit message in event (if not empty) over any data with the same key
 		if key == "message" && e.Message != "" {
 			continue
 		}
-		// Suppress error in event if processing raw event data (e.g. without valid marker)
-		if key == logrus.ErrorKey && !hasValidMarker {
+		// Suppress error and gosteno fields in event if processing raw event data (e.g. without valid marker)
+		if !hasValidMarker && isInternalKey(key) {
 			continue
 		}
-		var valueJsonBytes []byte
-		if valueJsonBytes, err = json.Marshal(value); err != nil {
-			return
+		sf.writeMember(w, e, "data", key, value)
+	}
+	if sf.strictContext {
+		sf.writeRelocatedContext(w, e, data, rawData)
+	}
+	w.endObject()
+}
+
+// Write the context keys not permitted by the Steno schema to data. Keys in data take precedence; a relocated key (or
+// the object of relocated keys) conflicting with one is renamed by prefixing underscores and the conflict is reported.
+func (sf *Formatter) writeRelocatedContext(w *eventWriter, e *logrus.Entry, data map[string]interface{}, rawData json.RawMessage) {
+	var rawKeys map[string]bool
+	if len(rawData) > 0 {
+		rawKeys = map[string]bool{}
+		if err := walkJsonMembers(rawData, func(key string, value json.RawMessage) { rawKeys[key] = true }); err != nil {
+			rawKeys[rawJsonErrorKey] = true
 		}
-		if err = writeKeyJsonValue(&buffer, key, valueJsonBytes); err != nil {
-			return
+	}
+	var isPresent func(key string) bool = func(key string) bool {
+		_, ok := data[key]
+		return ok || rawKeys[key] || key == "message" && e.Message != ""
+	}
+	if sf.contextRelocation == ContextRelocationPrefix {
+		var prefix string = ""
+		if sf.relocatedContextName != "" {
+			prefix = sf.relocatedContextName + "."
 		}
+		sf.writeRelocatedMembers(w, e, prefix, isPresent)
+		return
 	}
-	if buffer.Len() == 1 {
-		if _, err = buffer.WriteString("}"); err != nil {
-			return
+	var objectName string = sf.relocatedContextName
+	if objectName == "" {
+		objectName = defaultRelocatedContextName
+	}
+	var name string = freeRelocatedName(objectName, isPresent)
+	var objectMark writerMark = w.mark()
+	w.writeName(name)
+	w.beginObject()
+	var membersStart int = w.size()
+	sf.writeRelocatedMembers(w, e, "", func(key string) bool { return false })
+	if w.size() == membersStart {
+		w.rewind(objectMark)
+		return
+	}
+	if name != objectName {
+		sf.reportError(e, "context", "", relocationConflictError(objectName, name))
+	}
+	w.endObject()
+}
+
+// Write the relocated context keys with the prefix renaming those present.
+func (sf *Formatter) writeRelocatedMembers(w *eventWriter, e *logrus.Entry, prefix string, isPresent func(key string) bool) {
+	context, loggerName := getEntryContext(e)
+	var keys []string
+	for key, value := range context {
+		if sf.isRelocatedContextKey(key, value) {
+			keys = append(keys, key)
+		}
+	}
+	if _, ok := context["logger"]; sf.injectContextLogger && loggerName != "" && !ok {
+		keys = append(keys, "logger")
+	}
+
+	// Renamed keys must not conflict with the other relocated keys either
+	var taken map[string]bool
+	var isTaken func(name string) bool = func(name string) bool {
+		return isPresent(name) || taken[name]
+	}
+	for _, key := range keys {
+		var name string = prefix + key
+		if isPresent(name) {
+			if taken == nil {
+				taken = make(map[string]bool, len(keys))
+				for _, other := range keys {
+					taken[prefix + other] = true
+				}
+			}
+			name = freeRelocatedName(name, isTaken)
+			taken[name] = true
+			sf.reportError(e, "context", key, relocationConflictError(prefix + key, name))
+		}
+		if value, ok := context[key]; ok {
+			sf.writeNamedMember(w, e, "context", name, key, value)
+		} else {
+			w.writeName(name)
+			w.writeString(sf.loggerNameAbbreviator.abbreviate(loggerName))
 		}
-		jsonBytes = buffer.Bytes()
-	} else {
-		jsonBytes = buffer.Bytes()
-		jsonBytes[len(jsonBytes) - 1] = '}'
 	}
-	return
 }
 
-func (sf *Formatter) getContext(e *logrus.Entry) (jsonBytes []byte, err error) {
+// Return the name prefixed by underscores until it is not taken.
+func freeRelocatedName(name string, isTaken func(name string) bool) string {
+	for isTaken(name) {
+		name = "_" + name
+	}
+	return name
+}
+
+func relocationConflictError(name string, renamed string) error {
+	return fmt.Errorf("relocated context %s conflicts with data; relocated as %s", name, renamed)
+}
+
+// Whether the context key is relocated into data in strict context mode; the key is not permitted by the Steno schema,
+// its value is not a string or it conflicts with an injected key.
+func (sf *Formatter) isRelocatedContextKey(key string, value interface{}) bool {
+	if _, ok := value.(string); !ok || !stenoContextKeys[key] {
+		return true
+	}
+	switch key {
+	case "host":
+		return sf.injectContextHost
+	case "processId":
+		return sf.injectContextProcess
+	case "threadId":
+		return sf.injectContextThread
+	case "file":
+		return sf.injectContextFile
+	case "line":
+		return sf.injectContextLine
+	case "method":
+		return sf.injectContextMethod
+	case "namespace":
+		return sf.injectContextNamespace
+	}
+	return false
+}
+
+func (sf *Formatter) writeContext(w *eventWriter, e *logrus.Entry) {
+	var rawContext json.RawMessage
 	var context map[string]interface{}
 	var loggerName string
-	var marker interface{} = e.Data[MarkerKey]
-	switch marker := marker.(type) {
-	default:
-		context = nil
-		loggerName = ""
-	case *MapsMarker:
-		context = marker.ParseContext(e)
-		loggerName = marker.ParseLoggerName(e)
-	}
-	var buffer bytes.Buffer
-	if _, err = buffer.WriteString("{"); err != nil {
-		return
+	if sf.strictContext {
+		// The keys of the json object are relocated individually
+		context, loggerName = getEntryContext(e)
+	} else {
+		rawContext, context, loggerName = getEntryRawContext(e)
 	}
+	w.beginObject()
+	sf.writeRawMembers(w, e, "context", rawContext, context)
 	for key, value := range context {
-		var valueJsonBytes []byte
-		if valueJsonBytes, err = json.Marshal(value); err != nil {
-			return
-		}
-		if err = writeKeyJsonValue(&buffer, key, valueJsonBytes); err != nil {
-			return
+		if sf.strictContext && sf.isRelocatedContextKey(key, value) {
+			continue
 		}
+		sf.writeMember(w, e, "context", key, value)
 	}
 	if sf.injectContextHost {
-		if err = writeKeyStringValue(&buffer, "host", hostname); err != nil {
-			return
-		}
+		w.writeKey(keyHost)
+		w.writeString(hostname)
 	}
 	if sf.injectContextProcess {
-		if err = writeKeyStringValue(&buffer, "processId", processId); err != nil {
-			return
-		}
+		w.writeKey(keyProcessId)
+		w.writeString(processId)
 	}
-	if sf.injectContextLogger && loggerName != "" {
-		if err = writeKeyStringValue(&buffer, "logger", loggerName); err != nil {
-			return
-		}
+	if sf.injectContextLogger && loggerName != "" && !sf.strictContext {
+		w.writeKey(keyLogger)
+		w.writeString(sf.loggerNameAbbreviator.abbreviate(loggerName))
 	}
-	if buffer.Len() == 1 {
-		if _, err = buffer.WriteString("}"); err != nil {
-			return
-		}
-		jsonBytes = buffer.Bytes()
-	} else {
-		jsonBytes = buffer.Bytes()
-		jsonBytes[len(jsonBytes) - 1] = '}'
+	if sf.injectContextThread {
+		w.writeKey(keyThreadId)
+		w.writeString(getThreadId(e))
+	}
+	if sf.injectContextFile || sf.injectContextLine || sf.injectContextMethod || sf.injectContextNamespace {
+		sf.writeCaller(w)
 	}
-	return
+	w.endObject()
 }
 
-func (sf *Formatter) getError(e *logrus.Entry) (jsonBytes []byte, err error) {
-	var entryError error
-	var marker interface{} = e.Data[MarkerKey]
-	switch marker := marker.(type) {
-	default:
-		entryError = nil
-		if logrusError, ok := e.Data[logrus.ErrorKey].(error); ok {
-			entryError = logrusError
-		}
-	case *MapsMarker:
-		entryError = marker.ParseError(e)
+// Write the members of the json object, if any, to the object of the block as other members; members whose key is in
+// the values or is the message of the event are omitted. An invalid object is replaced by a placeholder and reported.
+func (sf *Formatter) writeRawMembers(w *eventWriter, e *logrus.Entry, block string, raw json.RawMessage, values map[string]interface{}) {
+	if len(raw) == 0 {
+		return
 	}
-	if entryError != nil {
-		var buffer bytes.Buffer
-		if _, err = buffer.WriteString("{"); err != nil {
+	var membersMark writerMark = w.mark()
+	var decode bool = sf.redactor != nil || sf.maxDepth > 0 || sf.maxElements > 0 || sf.maxStringLength > 0
+	var err error = walkJsonMembers(raw, func(key string, value json.RawMessage) {
+		if _, ok := values[key]; ok || block == "data" && key == "message" && e.Message != "" {
 			return
 		}
-		if err = writeKeyStringValue(&buffer, "type", "error"); err != nil {
-			return
-		}
-		if err = writeKeyStringValue(&buffer, "message", entryError.Error()); err != nil {
-			return
+		if decode {
+			sf.writeMember(w, e, block, key, decodeJsonValue(value))
+		} else {
+			sf.writeMember(w, e, block, key, value)
 		}
-		if err = writeKeyJsonValue(&buffer, "backtrace", []byte("[]")); err != nil {
+	})
+	if err != nil {
+		sf.reportError(e, block, "", err)
+		w.rewind(membersMark)
+		w.writeName(rawJsonErrorKey)
+		w.writeString(placeholder(err))
+	}
+}
+
+// Write the key and value as a member of the object in the block applying the redactor, if any.
+func (sf *Formatter) writeMember(w *eventWriter, e *logrus.Entry, block string, key string, value interface{}) {
+	sf.writeNamedMember(w, e, block, key, key, value)
+}
+
+// Write the value of the key as a member with the name (e.g. a relocated context key with a prefix).
+func (sf *Formatter) writeNamedMember(w *eventWriter, e *logrus.Entry, block string, name string, key string, value interface{}) {
+	var rule *redactionRule
+	if sf.redactor != nil {
+		if rule = sf.redactor.lookup(key); rule != nil && rule.mode == RedactionModeDrop {
 			return
 		}
-
-		jsonBytes = buffer.Bytes()
-		jsonBytes[len(jsonBytes) - 1] = '}'
 	}
-	return
+	w.writeName(name)
+	if rule != nil {
+		w.writeString(sf.redactor.redact(rule.mode, value))
+		return
+	}
+	sf.writeValue(w, e, block, key, value)
 }
 
-func writeKeyStringValue(buffer *bytes.Buffer, key string, value string) (err error) {
-	var bytes []byte
-	if bytes, err = json.Marshal(key); err != nil {
-		return
-	} else if _, err = buffer.Write(bytes); err != nil {
+// Write the value of the key in the block evaluating lazy values and applying the registered encoder, if any; a value
+// failing to encode is isolated as a placeholder and reported.
+func (sf *Formatter) writeValue(w *eventWriter, e *logrus.Entry, block string, key string, value interface{}) {
+	var err error
+	if value, err = resolveLazy(value); err != nil {
+		sf.reportError(e, block, key, err)
+		w.writeString(placeholder(err))
 		return
 	}
-	if _, err = buffer.WriteString(":"); err != nil {
+	if secret, ok := asSecret(value); ok {
+		w.writeString(sf.redactor.redactSecret(secret))
 		return
 	}
-	if bytes, err = json.Marshal(value); err != nil {
-		return
-	} else if _, err = buffer.Write(bytes); err != nil {
-		return
+	if sf.encoders != nil && value != nil {
+		if encoder := sf.encoders.lookup(reflect.TypeOf(value)); encoder != nil {
+			if value, err = callEncoder(encoder, value); err != nil {
+				sf.reportError(e, block, key, err)
+				w.writeString(placeholder(err))
+				return
+			}
+		}
 	}
-	if _, err = buffer.WriteString(","); err != nil {
-		return
+	var start writerMark = w.mark()
+	if sf.maxDepth > 0 || sf.maxElements > 0 || sf.maxStringLength > 0 || sf.redactor != nil || sf.encoders != nil {
+		var limits valueLimits = valueLimits{sf.maxDepth, sf.maxElements, sf.maxStringLength}
+		err = writeRedactedValue(w, value, limits, sf.redactor, sf.encoders)
+	} else if err = w.writeValue(value); err != nil && isCycleError(err) {
+		// Replace only the references completing a cycle instead of the entire value
+		w.rewind(start)
+		err = writeRedactedValue(w, value, valueLimits{}, nil, nil)
+	}
+	if err != nil {
+		sf.reportError(e, block, key, err)
+	}
+	if sf.maxEventSize > 0 && w.size() > sf.maxEventSize {
+		var size int = w.size() - start.offset
+		w.rewind(start)
+		w.writeString(truncatedMarker(size, "bytes"))
 	}
-	return nil
 }
 
-func writeKeyJsonValue(buffer *bytes.Buffer, key string, jsonBytes []byte) (err error) {
-	var bytes []byte
-	if bytes, err = json.Marshal(key); err != nil {
-		return
-	} else if _, err = buffer.Write(bytes); err != nil {
-		return
+// The logical thread identifier is captured when the event is logged; otherwise, since logrus formats the event
+// synchronously, the current goroutine is the one logging the event.
+func getThreadId(e *logrus.Entry) string {
+	if threadId, ok := e.Data[ThreadKey].(string); ok && threadId != "" {
+		return threadId
 	}
-	if _, err = buffer.WriteString(":"); err != nil {
+	return goroutineId()
+}
+
+func (sf *Formatter) writeCaller(w *eventWriter) {
+	frame, ok := findCaller(sf.callerSkipFrames)
+	if !ok {
 		return
 	}
-	if _, err = buffer.Write(jsonBytes); err != nil {
-		return
+	namespace, method := splitFunctionName(frame.function)
+	if sf.injectContextFile {
+		w.writeKey(keyFile)
+		w.writeString(filepath.Base(frame.file))
 	}
-	if _, err = buffer.WriteString(","); err != nil {
-		return
+	if sf.injectContextLine {
+		w.writeKey(keyLine)
+		w.writeStringBytes(strconv.AppendInt(w.scratch(), int64(frame.line), 10))
+	}
+	if sf.injectContextMethod {
+		w.writeKey(keyMethod)
+		w.writeString(method)
+	}
+	if sf.injectContextNamespace {
+		w.writeKey(keyNamespace)
+		w.writeString(namespace)
 	}
-	return nil
 }
 
-func writeError(buffer *bytes.Buffer, internalError error) (err error) {
-	var internalErrorAsMap = map[string]interface{} {
-		"message": internalError.Error(),
-	}
-	var bytes []byte
-	if bytes, err = json.Marshal(internalErrorAsMap); err != nil {
+func (sf *Formatter) writeException(w *eventWriter, e *logrus.Entry) {
+	var entryError error = getEntryError(e)
+	if entryError == nil {
 		return
 	}
-	if _, err = buffer.Write(bytes); err != nil {
-		return
+	w.writeKey(keyException)
+	w.beginObject()
+	w.writeKey(keyType)
+	w.writeString(getErrorType(entryError))
+	w.writeKey(keyMessage)
+	w.writeString(sf.getErrorMessage(e, entryError))
+	w.writeKey(keyBacktrace)
+	w.beginArray()
+	for _, line := range sf.getBacktrace(e) {
+		w.writeString(line)
 	}
-	if _, err = buffer.WriteString(","); err != nil {
-		return
+	w.endArray()
+	sf.writeExceptionData(w, e, entryError, 0)
+	w.endObject()
+}
+
+func (sf *Formatter) getBacktrace(e *logrus.Entry) []string {
+	if sf.injectBacktrace[e.Level] {
+		if s, ok := e.Data[StackKey].(stack); ok {
+			return s.backtrace(sf.backtraceDepth, sf.backtraceFilters)
+		}
 	}
 	return nil
 }
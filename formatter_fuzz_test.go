@@ -0,0 +1,65 @@
+//go:build go1.18
+// +build go1.18
+
+/*
+Copyright 2016 Ville Koskela
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package gosteno
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+	"github.com/Sirupsen/logrus"
+)
+
+func FuzzFormatter(f *testing.F) {
+	f.Add("message", "key", "value", 3.14, []byte("bytes"), "This is an error")
+	f.Add("", "message", "\x00\xff\u2028", math.NaN(), []byte{0xff, 0xfe}, "")
+	f.Add("\"}", "data", "{\"", math.Inf(-1), []byte(nil), "\xc3\x28")
+	f.Fuzz(func(t *testing.T, message string, key string, value string, number float64, raw []byte, errorMessage string) {
+		var formatter *Formatter = NewFormatter()
+		formatter.SetInjectContextLogger(true)
+		formatter.SetStrictContext(true)
+		logger, buffer := HelperTestGetLogger(key, logrus.DebugLevel, formatter)
+		logger.DebugBuilder().
+			SetEvent(value).
+			SetMessage(message).
+			SetError(errors.New(errorMessage)).
+			AddData(key, value).
+			AddData("number", number).
+			AddData("raw", raw).
+			AddData("chan", make(chan string)).
+			AddData("map", map[subWidget]string{subWidget{key}: value}).
+			AddData("nested", map[string]interface{}{key: number, value: raw}).
+			AddContext(key, value).
+			AddContext("host", value).
+			Log()
+		HelperTestValidate(t, buffer.Bytes())
+		var event map[string]interface{}
+		if err := json.Unmarshal(buffer.Bytes(), &event); err != nil {
+			t.Fatalf("Event is not valid json because %v in buffer %s", err, buffer.String())
+		}
+		for _, k := range []string{"time", "name", "level", "data", "context", "exception", "id", "version"} {
+			if _, ok := event[k]; !ok {
+				t.Fatalf("Event is missing %s in buffer %s", k, buffer.String())
+			}
+		}
+		if data, ok := event["data"].(map[string]interface{}); !ok || data["number"] == nil || data["chan"] == nil {
+			t.Fatalf("Event data is incomplete in buffer %s", buffer.String())
+		}
+	})
+}
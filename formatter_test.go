@@ -16,11 +16,85 @@ limitations under the License.
 package gosteno
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math"
+	"runtime"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 	"github.com/Sirupsen/logrus"
-	"errors"
 )
 
+type testDomainError struct {
+	message string
+}
+
+func (e *testDomainError) Error() string {
+	return e.message
+}
+
+type testTypedError struct {
+	testDomainError
+}
+
+func (e *testTypedError) StenoErrorType() string {
+	return "DomainError"
+}
+
+type testDataError struct {
+	testDomainError
+	data map[string]interface{}
+	cause error
+}
+
+func (e *testDataError) Unwrap() error {
+	return e.cause
+}
+
+func (e *testDataError) StenoErrorData() map[string]interface{} {
+	return e.data
+}
+
+type testWrappedError struct {
+	testDomainError
+	cause error
+}
+
+func (e *testWrappedError) Unwrap() error {
+	return e.cause
+}
+
+type testJoinedError struct {
+	testDomainError
+	causes []error
+}
+
+func (e *testJoinedError) Unwrap() []error {
+	return e.causes
+}
+
+type testPanickingTypedError struct {
+	testDomainError
+}
+
+func (e *testPanickingTypedError) StenoErrorType() string {
+	panic("type failed")
+}
+
+func (e *testPanickingTypedError) StenoErrorData() map[string]interface{} {
+	panic("data failed")
+}
+
+type testPanicMarshaler struct {
+}
+
+func (m testPanicMarshaler) MarshalJSON() ([]byte, error) {
+	panic("marshal failed")
+}
+
 type subWidget struct {
 	Name string
 }
@@ -32,7 +106,6 @@ type widget struct {
 
 // TODO:
 // 1) Test catastropic failure resulting in no log message.
-// 2) Test data/context serialization failure resulting in skeleton message.
 
 const (
 	formatterTestDataPath = "./testdata/formatter_test/"
@@ -52,6 +125,18 @@ func TestFormatterDefaults(t *testing.T) {
 	if v := formatter.LogEventName(); v != "log" {
 		t.Errorf("Incorrect default value for log event name %v", v)
 	}
+	if v := formatter.BacktraceDepth(); v != 32 {
+		t.Errorf("Incorrect default value for backtrace depth %v", v)
+	}
+	if v := formatter.InjectBacktrace(logrus.InfoLevel); v != false {
+		t.Errorf("Incorrect default value for inject backtrace at info %v", v)
+	}
+	if v := formatter.InjectBacktrace(logrus.ErrorLevel); v != true {
+		t.Errorf("Incorrect default value for inject backtrace at error %v", v)
+	}
+	if v := formatter.StrictLevelNames(); v != true {
+		t.Errorf("Incorrect default value for strict level names %v", v)
+	}
 }
 
 func TestFormatterLevelMapping(t *testing.T) {
@@ -74,6 +159,115 @@ func TestFormatterLevelMapping(t *testing.T) {
 	if v := formatter.getLevel(&logrus.Entry{Level: logrus.PanicLevel}); v != "fatal" {
 		t.Errorf("Incorrect level for PanicLevel %v", v)
 	}
+	if v := formatter.getLevel(&logrus.Entry{Level: logrus.Level(6)}); v != "debug" {
+		t.Errorf("Incorrect level for TraceLevel %v", v)
+	}
+	if v := formatter.getLevel(&logrus.Entry{Level: logrus.Level(42)}); v != "unknown" {
+		t.Errorf("Incorrect level for undefined level %v", v)
+	}
+}
+
+func TestFormatterCustomLevelMapping(t *testing.T) {
+	t.Parallel()
+	var formatter *Formatter = NewFormatter()
+	if err := formatter.SetLevelName(logrus.PanicLevel, "crit"); err != nil {
+		t.Errorf("Unexpected failure setting steno level name %v", err)
+	}
+	if v := formatter.LevelName(logrus.PanicLevel); v != "crit" {
+		t.Errorf("Incorrect level for PanicLevel %v", v)
+	}
+	if err := formatter.SetLevelName(logrus.ErrorLevel, "error"); err == nil {
+		t.Errorf("Expected failure setting non-steno level name in strict mode")
+	}
+	if v := formatter.LevelName(logrus.ErrorLevel); v != "crit" {
+		t.Errorf("Incorrect level for ErrorLevel after rejected name %v", v)
+	}
+	if err := formatter.SetStrictLevelNames(false); err != nil {
+		t.Errorf("Unexpected failure disabling strict level names %v", err)
+	}
+	if err := formatter.SetLevelName(logrus.ErrorLevel, "error"); err != nil {
+		t.Errorf("Unexpected failure setting level name %v", err)
+	}
+	if v := formatter.LevelName(logrus.ErrorLevel); v != "error" {
+		t.Errorf("Incorrect level for ErrorLevel %v", v)
+	}
+	if err := formatter.SetStrictLevelNames(true); err == nil || formatter.StrictLevelNames() {
+		t.Errorf("Expected failure enabling strict level names with non-steno level name")
+	}
+	if v := NewFormatter().LevelName(logrus.ErrorLevel); v != "crit" {
+		t.Errorf("Incorrect level for ErrorLevel of another formatter %v", v)
+	}
+	if v := new(Formatter).LevelName(logrus.InfoLevel); v != "info" {
+		t.Errorf("Incorrect level for InfoLevel of zero formatter %v", v)
+	}
+}
+
+func TestFormatterTimeFormat(t *testing.T) {
+	t.Parallel()
+	var entry *logrus.Entry = &logrus.Entry{Time: time.Date(2016, 1, 2, 3, 4, 5, 60000000, time.UTC)}
+	var formatter *Formatter = NewFormatter()
+	if v := formatter.getTime(entry); v != "2016-01-02T03:04:05.06Z" {
+		t.Errorf("Incorrect time for default format %v", v)
+	}
+	formatter.SetTimeFormat(TimeFormatRFC3339Millis)
+	if v := formatter.getTime(entry); v != "2016-01-02T03:04:05.060Z" {
+		t.Errorf("Incorrect time for millisecond format %v", v)
+	}
+	formatter.SetTimeFormat(TimeFormatRFC3339Micros)
+	if v := formatter.getTime(entry); v != "2016-01-02T03:04:05.060000Z" {
+		t.Errorf("Incorrect time for microsecond format %v", v)
+	}
+	formatter.SetTimeFormat(TimeFormatRFC3339NanosFixed)
+	if v := formatter.getTime(entry); v != "2016-01-02T03:04:05.060000000Z" {
+		t.Errorf("Incorrect time for fixed nanosecond format %v", v)
+	}
+	formatter.SetTimeLocation(time.FixedZone("PST", -8 * 60 * 60))
+	if v := formatter.getTime(entry); v != "2016-01-01T19:04:05.060000000-08:00" {
+		t.Errorf("Incorrect time for location %v", v)
+	}
+	formatter.SetTimeFormat(TimeFormatEpochMillis)
+	if v := formatter.getTime(entry); v != "1451703845060" {
+		t.Errorf("Incorrect time for epoch millisecond format %v", v)
+	}
+}
+
+func TestFormatterFixedClock(t *testing.T) {
+	t.Parallel()
+	var formatter *Formatter = helperTestGetExactFormatter()
+	logger, buffer := HelperTestGetLogger("TestFormatterFixedClock", logrus.DebugLevel, formatter)
+	logger = logger.WithClock(NewFixedClock(time.Date(2016, 1, 2, 3, 4, 5, 60000000, time.UTC)))
+	logger.DebugBuilder().SetMessage("TestFormatterFixedClock").Log()
+	HelperTestVerifyExact(t, buffer, formatterTestDataPath + "TestFormatterFixedClock.expected.json")
+}
+
+func TestFormatterFixedClockPrint(t *testing.T) {
+	t.Parallel()
+	var formatter *Formatter = helperTestGetExactFormatter()
+	formatter.SetTimeFormat(TimeFormatRFC3339Millis)
+	logger, buffer := HelperTestGetLogger("TestFormatterFixedClockPrint", logrus.DebugLevel, formatter)
+	logger = logger.WithClock(NewFixedClock(time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC)))
+	logger.Print("TestFormatterFixedClockPrint")
+	HelperTestVerifyExact(t, buffer, formatterTestDataPath + "TestFormatterFixedClockPrint.expected.json")
+}
+
+func TestFormatterEpochMillis(t *testing.T) {
+	t.Parallel()
+	var formatter *Formatter = helperTestGetExactFormatter()
+	formatter.SetTimeFormat(TimeFormatEpochMillis)
+	logger, buffer := HelperTestGetLogger("TestFormatterEpochMillis", logrus.DebugLevel, formatter)
+	var builder *DefaultLogBuilder = NewDefaultLogBuilder(logger.logger, logrus.InfoLevel, "TestFormatterEpochMillis")
+	builder.SetClock(NewFixedClock(time.Date(2016, 1, 2, 3, 4, 5, 60000000, time.UTC)))
+	builder.SetMessage("TestFormatterEpochMillis").Log()
+	HelperTestVerifyExact(t, buffer, formatterTestDataPath + "TestFormatterEpochMillis.expected.json")
+}
+
+// Return a formatter omitting the non-deterministic parts of the event other than time.
+func helperTestGetExactFormatter() *Formatter {
+	var formatter *Formatter = NewFormatter()
+	formatter.SetInjectContextHost(false)
+	formatter.SetInjectContextProcess(false)
+	formatter.SetIdGenerator(NewNoIdGenerator())
+	return formatter
 }
 
 func TestFormatterGlobalDefaultEventName(t *testing.T) {
@@ -111,6 +305,115 @@ func TestFormatterEnableLoggerName(t *testing.T) {
 	HelperTestVerifyIgnoreContext(t, buffer, formatterTestDataPath + "TestFormatterEnableLoggerName.expected.json", []string{"logger"})
 }
 
+func TestFormatterInjectCaller(t *testing.T) {
+	t.Parallel()
+	var formatter *Formatter = NewFormatter()
+	formatter.SetInjectContextFile(true)
+	formatter.SetInjectContextLine(true)
+	formatter.SetInjectContextMethod(true)
+	formatter.SetInjectContextNamespace(true)
+	logger, buffer := HelperTestGetLogger("TestFormatterInjectCaller", logrus.DebugLevel, formatter)
+	var line int
+
+	_, _, line, _ = runtime.Caller(0); logger.DebugBuilder().SetMessage("TestFormatterInjectCaller").Log()
+	helperTestVerifyCaller(t, buffer, "TestFormatterInjectCaller", line)
+
+	_, _, line, _ = runtime.Caller(0); logger.Info("TestFormatterInjectCaller")
+	helperTestVerifyCaller(t, buffer, "TestFormatterInjectCaller", line)
+
+	_, _, line, _ = runtime.Caller(0); logger.Infof("%s", "TestFormatterInjectCaller")
+	helperTestVerifyCaller(t, buffer, "TestFormatterInjectCaller", line)
+
+	_, _, line, _ = runtime.Caller(0); logger.WithField("foo", "bar").Info("TestFormatterInjectCaller")
+	helperTestVerifyCaller(t, buffer, "TestFormatterInjectCaller", line)
+}
+
+func TestFormatterInjectCallerSkipFrames(t *testing.T) {
+	t.Parallel()
+	var formatter *Formatter = NewFormatter()
+	formatter.SetInjectContextLine(true)
+	formatter.SetInjectContextMethod(true)
+	formatter.SetCallerSkipFrames(1)
+	logger, buffer := HelperTestGetLogger("TestFormatterInjectCallerSkipFrames", logrus.DebugLevel, formatter)
+	var line int
+	_, _, line, _ = runtime.Caller(0); helperTestLogWrapper(logger, "TestFormatterInjectCallerSkipFrames")
+	helperTestVerifyCaller(t, buffer, "TestFormatterInjectCallerSkipFrames", line)
+}
+
+func helperTestLogWrapper(logger *Logger, message string) {
+	logger.InfoBuilder().SetMessage(message).Log()
+}
+
+func helperTestVerifyCaller(t *testing.T, buffer *bytes.Buffer, method string, line int) {
+	var context map[string]string = helperTestGetContext(t, buffer)
+	if v, ok := context["file"]; ok && v != "formatter_test.go" {
+		t.Errorf("Incorrect caller file %v", v)
+	}
+	if v := context["line"]; v != strconv.Itoa(line) {
+		t.Errorf("Incorrect caller line %v expected %d", v, line)
+	}
+	if v := context["method"]; v != method {
+		t.Errorf("Incorrect caller method %v", v)
+	}
+	if v, ok := context["namespace"]; ok && v != packagePath {
+		t.Errorf("Incorrect caller namespace %v", v)
+	}
+}
+
+func TestFormatterInjectThread(t *testing.T) {
+	t.Parallel()
+	var formatter *Formatter = NewFormatter()
+	formatter.SetInjectContextThread(true)
+	logger, buffer := HelperTestGetLogger("TestFormatterInjectThread", logrus.DebugLevel, formatter)
+	logger.DebugBuilder().SetMessage("TestFormatterInjectThread").Log()
+	var threadId string = helperTestGetContext(t, buffer)["threadId"]
+	if _, err := strconv.Atoi(threadId); err != nil {
+		t.Errorf("Thread is not goroutine identifier %v", threadId)
+	}
+	var done chan bool = make(chan bool)
+	go func() {
+		logger.Info("TestFormatterInjectThread")
+		done <- true
+	}()
+	<-done
+	if v := helperTestGetContext(t, buffer)["threadId"]; v == "" || v == threadId {
+		t.Errorf("Thread is not identifier of logging goroutine %v", v)
+	}
+}
+
+func TestFormatterInjectLogicalThread(t *testing.T) {
+	t.Parallel()
+	var formatter *Formatter = NewFormatter()
+	formatter.SetInjectContextThread(true)
+	logger, buffer := HelperTestGetLogger("TestFormatterInjectLogicalThread", logrus.DebugLevel, formatter)
+	logger = logger.WithThreadId("worker-7")
+	logger.DebugBuilder().SetMessage("TestFormatterInjectLogicalThread").Log()
+	if v := helperTestGetContext(t, buffer)["threadId"]; v != "worker-7" {
+		t.Errorf("Incorrect thread from builder %v", v)
+	}
+	logger.Debug("TestFormatterInjectLogicalThread")
+	if v := helperTestGetContext(t, buffer)["threadId"]; v != "worker-7" {
+		t.Errorf("Incorrect thread from logger %v", v)
+	}
+	logger.Debugf("%s", "TestFormatterInjectLogicalThread")
+	if v := helperTestGetContext(t, buffer)["threadId"]; v != "worker-7" {
+		t.Errorf("Incorrect thread from logrus format %v", v)
+	}
+	logger.WithField("foo", "bar").Debug("TestFormatterInjectLogicalThread")
+	HelperTestVerify(t, buffer, formatterTestDataPath + "TestFormatterInjectLogicalThread.expected.json")
+}
+
+func helperTestGetContext(t *testing.T, buffer *bytes.Buffer) map[string]string {
+	var event struct {
+		Context map[string]string
+	}
+	if err := json.Unmarshal(buffer.Bytes(), &event); err != nil {
+		t.Errorf("Unmarshal of actual failed because %v in buffer %s", err, buffer.String())
+	}
+	buffer.Reset()
+	return event.Context
+}
+
 func TestFormatterDisableProcess(t *testing.T) {
 	t.Parallel()
 	var formatter *Formatter = NewFormatter()
@@ -187,6 +490,96 @@ func TestFormatterComplexData(t *testing.T) {
 	HelperTestVerify(t, buffer, formatterTestDataPath + "TestFormatterComplexData.expected.json")
 }
 
+func TestFormatterUnmarshalableData(t *testing.T) {
+	t.Parallel()
+	var formatter *Formatter = NewFormatter()
+	logger, buffer := HelperTestGetLogger("TestFormatterUnmarshalableData", logrus.DebugLevel, formatter)
+	logger.DebugBuilder().
+		AddData("foo", "bar").
+		AddData("nan", math.NaN()).
+		AddData("chan", make(chan int)).
+		AddData("panic", testPanicMarshaler{}).
+		AddContext("inf", math.Inf(1)).
+		SetError(&testDataError{testDomainError{"This is an error"}, map[string]interface{}{"func": func() {}}, nil}).
+		SetMessage("TestFormatterUnmarshalableData").
+		Log()
+	HelperTestVerifyIgnoreContext(
+		t,
+		buffer,
+		formatterTestDataPath + "TestFormatterUnmarshalableData.expected.json",
+		[]string{"inf"})
+}
+
+func TestFormatterErrorHandler(t *testing.T) {
+	t.Parallel()
+	var formatter *Formatter = NewFormatter()
+	var failures []*FormatError
+	formatter.SetErrorHandler(func(err error, e *logrus.Entry) {
+		failures = append(failures, err.(*FormatError))
+	})
+	logger, buffer := HelperTestGetLogger("TestFormatterErrorHandler", logrus.DebugLevel, formatter)
+	logger.DebugBuilder().
+		SetEvent("my_event").
+		AddData("foo", "bar").
+		AddData("nan", math.NaN()).
+		AddContext("chan", make(chan int)).
+		Log()
+	if len(failures) != 2 {
+		t.Fatalf("Incorrect number of failures reported %v", failures)
+	}
+	if failures[0].Event != "my_event" || failures[0].Block != "data" || failures[0].Key != "nan" {
+		t.Errorf("Incorrect failure reported for data %v", failures[0])
+	}
+	if failures[1].Event != "my_event" || failures[1].Block != "context" || failures[1].Key != "chan" {
+		t.Errorf("Incorrect failure reported for context %v", failures[1])
+	}
+	if v := formatter.ErrorCount(); v != 2 {
+		t.Errorf("Incorrect error count %v", v)
+	}
+	buffer.Reset()
+	logger.DebugBuilder().SetError(&testDataError{testDomainError{"This is an error"}, map[string]interface{}{"func": func() {}}, nil}).Log()
+	if len(failures) != 3 || failures[2].Block != "exception" || failures[2].Key != "func" {
+		t.Errorf("Incorrect failure reported for exception %v", failures)
+	}
+	if v := formatter.ErrorCount(); v != 3 {
+		t.Errorf("Incorrect error count %v", v)
+	}
+}
+
+func TestFormatterWithPanickingError(t *testing.T) {
+	t.Parallel()
+	var formatter *Formatter = NewFormatter()
+	logger, buffer := HelperTestGetLogger("TestFormatterWithPanickingError", logrus.DebugLevel, formatter)
+	var nilError *testDomainError
+	logger.DebugBuilder().SetError(nilError).SetMessage("TestFormatterWithPanickingError").Log()
+	if v := helperTestGetException(t, buffer)["message"]; !strings.HasPrefix(v.(string), "<error: panic: ") {
+		t.Errorf("Incorrect message for panicking error %v", v)
+	}
+	if v := formatter.ErrorCount(); v != 1 {
+		t.Errorf("Incorrect error count %v", v)
+	}
+}
+
+func TestFormatterWithPanickingErrorTypeAndData(t *testing.T) {
+	t.Parallel()
+	var formatter *Formatter = NewFormatter()
+	logger, buffer := HelperTestGetLogger("TestFormatterWithPanickingErrorTypeAndData", logrus.DebugLevel, formatter)
+	logger.DebugBuilder().
+			SetError(&testPanickingTypedError{testDomainError{"This is an error"}}).
+			SetMessage("TestFormatterWithPanickingErrorTypeAndData").
+			Log()
+	var exception map[string]interface{} = helperTestGetException(t, buffer)
+	if v := exception["type"]; v != "<error: panic: type failed>" {
+		t.Errorf("Incorrect type for panicking error %v", v)
+	}
+	if v := exception["data"].(map[string]interface{})["_error"]; v != "<error: panic: data failed>" {
+		t.Errorf("Incorrect data for panicking error %v", v)
+	}
+	if v := formatter.ErrorCount(); v != 1 {
+		t.Errorf("Incorrect error count %v", v)
+	}
+}
+
 func TestFormatterWithError(t *testing.T) {
 	t.Parallel()
 	var formatter *Formatter = NewFormatter()
@@ -203,6 +596,147 @@ func TestFormatterWithLogrusError(t *testing.T) {
 	HelperTestVerify(t, buffer, formatterTestDataPath + "TestFormatterWithLogrusError.expected.json")
 }
 
+func TestFormatterWithWrappedError(t *testing.T) {
+	t.Parallel()
+	var formatter *Formatter = NewFormatter()
+	logger, buffer := HelperTestGetLogger("TestFormatterWithWrappedError", logrus.DebugLevel, formatter)
+	var joined error = &testJoinedError{testDomainError{"first\nsecond: third"},
+		[]error{errors.New("first"), &testWrappedError{testDomainError{"second: third"}, errors.New("third")}}}
+	logger.DebugBuilder().
+		SetError(&testWrappedError{testDomainError{"wrapped: first\nsecond: third"}, joined}).
+		SetMessage("TestFormatterWithWrappedError").
+		Log()
+	HelperTestVerify(t, buffer, formatterTestDataPath + "TestFormatterWithWrappedError.expected.json")
+}
+
+func TestFormatterWithWrappedErrorCausesDisabled(t *testing.T) {
+	t.Parallel()
+	var formatter *Formatter = NewFormatter()
+	formatter.SetInjectExceptionCauses(false)
+	logger, buffer := HelperTestGetLogger("TestFormatterWithWrappedErrorCausesDisabled", logrus.DebugLevel, formatter)
+	var err error = &testWrappedError{testDomainError{"wrapped: cause"}, errors.New("cause")}
+	logger.WithError(err).Debug("TestFormatterWithWrappedErrorCausesDisabled")
+	HelperTestVerify(t, buffer, formatterTestDataPath + "TestFormatterWithWrappedErrorCausesDisabled.expected.json")
+}
+
+func TestFormatterWithDataError(t *testing.T) {
+	t.Parallel()
+	var formatter *Formatter = NewFormatter()
+	logger, buffer := HelperTestGetLogger("TestFormatterWithDataError", logrus.DebugLevel, formatter)
+	var dataError error = &testDataError{
+		testDomainError{"This is an error"},
+		map[string]interface{}{"requestId": "abc", "retries": 3, "causes": "not a cause"},
+		nil}
+	logger.DebugBuilder().
+		SetError(&testDataError{
+			testDomainError{"wrapped: This is an error"},
+			map[string]interface{}{"status": 503, "causes": "ignored"},
+			dataError}).
+		SetMessage("TestFormatterWithDataError").
+		Log()
+	HelperTestVerify(t, buffer, formatterTestDataPath + "TestFormatterWithDataError.expected.json")
+}
+
+func TestFormatterErrorType(t *testing.T) {
+	t.Parallel()
+	var formatter *Formatter = NewFormatter()
+	logger, buffer := HelperTestGetLogger("TestFormatterErrorType", logrus.DebugLevel, formatter)
+	var expectedType string = "*" + packagePath + ".testDomainError"
+	logger.DebugBuilder().SetError(&testDomainError{"This is an error"}).SetMessage("TestFormatterErrorType").Log()
+	if v := helperTestGetException(t, buffer)["type"]; v != expectedType {
+		t.Errorf("Incorrect exception type from marker %v", v)
+	}
+	buffer.Reset()
+	logger.WithError(&testDomainError{"This is an error"}).Debug("TestFormatterErrorType")
+	if v := helperTestGetException(t, buffer)["type"]; v != expectedType {
+		t.Errorf("Incorrect exception type from logrus %v", v)
+	}
+	buffer.Reset()
+	logger.logger.WithError(&testTypedError{testDomainError{"This is an error"}}).Debug("TestFormatterErrorType")
+	if v := helperTestGetException(t, buffer)["type"]; v != "DomainError" {
+		t.Errorf("Incorrect exception type from typed error %v", v)
+	}
+}
+
+func TestFormatterBacktrace(t *testing.T) {
+	t.Parallel()
+	var formatter *Formatter = NewFormatter()
+	formatter.SetBacktraceFilters([]string{})
+	logger, buffer := HelperTestGetLogger("TestFormatterBacktrace", logrus.DebugLevel, formatter)
+	logger.ErrorBuilder().SetError(errors.New("This is an error")).SetMessage("TestFormatterBacktrace").Log()
+	var backtrace []string = helperTestGetBacktrace(t, buffer)
+	if len(backtrace) == 0 || !strings.Contains(backtrace[0], "TestFormatterBacktrace(") {
+		t.Errorf("Backtrace does not start at caller %v", backtrace)
+	}
+}
+
+func TestFormatterBacktraceFiltered(t *testing.T) {
+	t.Parallel()
+	var formatter *Formatter = NewFormatter()
+	logger, buffer := HelperTestGetLogger("TestFormatterBacktraceFiltered", logrus.DebugLevel, formatter)
+	logger.WithError(errors.New("This is an error")).Error("TestFormatterBacktraceFiltered")
+	var backtrace []string = helperTestGetBacktrace(t, buffer)
+	if len(backtrace) == 0 {
+		t.Errorf("Backtrace is empty")
+	}
+	for _, line := range backtrace {
+		if strings.HasPrefix(line, packagePath + ".") || strings.Contains(line, "logrus.") {
+			t.Errorf("Backtrace contains filtered frame %s", line)
+		}
+	}
+}
+
+func TestFormatterBacktraceDepth(t *testing.T) {
+	t.Parallel()
+	var formatter *Formatter = NewFormatter()
+	formatter.SetBacktraceFilters([]string{})
+	formatter.SetBacktraceDepth(1)
+	logger, buffer := HelperTestGetLogger("TestFormatterBacktraceDepth", logrus.DebugLevel, formatter)
+	MarkerMaps.Encode(logger.logger, "", "", nil, nil, errors.New("This is an error")).Error("TestFormatterBacktraceDepth")
+	if backtrace := helperTestGetBacktrace(t, buffer); len(backtrace) != 1 {
+		t.Errorf("Backtrace not limited to depth %v", backtrace)
+	}
+}
+
+func TestFormatterBacktraceLevel(t *testing.T) {
+	t.Parallel()
+	var formatter *Formatter = NewFormatter()
+	formatter.SetInjectBacktrace(logrus.ErrorLevel, false)
+	formatter.SetInjectBacktrace(logrus.DebugLevel, true)
+	logger, buffer := HelperTestGetLogger("TestFormatterBacktraceLevel", logrus.DebugLevel, formatter)
+	logger.ErrorBuilder().SetError(errors.New("This is an error")).SetMessage("TestFormatterBacktraceLevel").Log()
+	if backtrace := helperTestGetBacktrace(t, buffer); len(backtrace) != 0 {
+		t.Errorf("Backtrace injected when disabled for level %v", backtrace)
+	}
+	buffer.Reset()
+	logger.DebugBuilder().SetError(errors.New("This is an error")).SetMessage("TestFormatterBacktraceLevel").Log()
+	if backtrace := helperTestGetBacktrace(t, buffer); len(backtrace) == 0 {
+		t.Errorf("Backtrace not injected when enabled for level")
+	}
+}
+
+func helperTestGetException(t *testing.T, buffer *bytes.Buffer) map[string]interface{} {
+	var event struct {
+		Exception map[string]interface{}
+	}
+	if err := json.Unmarshal(buffer.Bytes(), &event); err != nil {
+		t.Errorf("Unmarshal of actual failed because %v in buffer %s", err, buffer.String())
+	}
+	return event.Exception
+}
+
+func helperTestGetBacktrace(t *testing.T, buffer *bytes.Buffer) []string {
+	var event struct {
+		Exception struct {
+			Backtrace []string
+		}
+	}
+	if err := json.Unmarshal(buffer.Bytes(), &event); err != nil {
+		t.Errorf("Unmarshal of actual failed because %v in buffer %s", err, buffer.String())
+	}
+	return event.Exception.Backtrace
+}
+
 func createWidget(name string) (widget) {
 	var parts []subWidget = make([]subWidget, 2, 2)
 	parts[0] = *new(subWidget)
@@ -213,4 +747,214 @@ func createWidget(name string) (widget) {
 	w.Name = name
 	w.Parts = &parts
 	return *w
-}
\ No newline at end of file
+}
+
+func BenchmarkFormatterMessage(b *testing.B) {
+	var formatter *Formatter = NewFormatter()
+	var entry *logrus.Entry = MarkerMaps.Encode(logrus.New(), "", "benchmark", map[string]interface{}{}, map[string]interface{}{}, nil)
+	helperBenchmarkFormat(b, formatter, entry)
+}
+
+func BenchmarkFormatterDataAndContext(b *testing.B) {
+	var formatter *Formatter = NewFormatter()
+	formatter.SetInjectContextLogger(true)
+	var entry *logrus.Entry = MarkerMaps.Encode(
+		logrus.New(),
+		"benchmark_event",
+		"benchmark",
+		map[string]interface{}{"userId": "bb486dfd-d7c5-4e3f-8391-c39d9fee6cac", "count": 42, "ratio": 0.75, "enabled": true},
+		map[string]interface{}{"requestId": "3186ea94-bca3-4a75-8ba2-b01151e9935c"},
+		errors.New("This is an error"))
+	helperBenchmarkFormat(b, formatter, entry)
+}
+
+func BenchmarkFormatterLogrusFields(b *testing.B) {
+	var formatter *Formatter = NewFormatter()
+	var entry *logrus.Entry = logrus.NewEntry(logrus.New()).WithFields(logrus.Fields{"foo": "bar", "one": 1, "pi": 3.14})
+	helperBenchmarkFormat(b, formatter, entry)
+}
+
+func helperBenchmarkFormat(b *testing.B, formatter *Formatter, entry *logrus.Entry) {
+	entry.Message = "This is a message from the steno logger"
+	entry.Level = logrus.InfoLevel
+	entry.Time = time.Now()
+	entry.Buffer = new(bytes.Buffer)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		entry.Buffer.Reset()
+		if _, err := formatter.Format(entry); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestFormatterStrictContextObject(t *testing.T) {
+	t.Parallel()
+	var formatter *Formatter = NewFormatter()
+	formatter.SetStrictContext(true)
+	formatter.SetInjectContextLogger(true)
+	formatter.SetInjectContextThread(true)
+	logger, buffer := HelperTestGetLogger("TestFormatterStrictContextObject", logrus.DebugLevel, formatter)
+	logger.InfoBuilder().
+			SetMessage("TestFormatterStrictContextObject").
+			AddData("key", "value").
+			AddContext("requestId", "abc").
+			AddContext("class", "Widget").
+			AddContext("line", 42).
+			AddContext("threadId", "custom").
+			Log()
+	HelperTestValidate(t, buffer.Bytes())
+	var event map[string]map[string]interface{}
+	helperTestUnmarshalBlocks(t, buffer.Bytes(), &event)
+	helperTestVerifyLimitedValue(
+		t,
+		event["data"],
+		"context",
+		`{"line":42,"logger":"TestFormatterStrictContextObject","requestId":"abc","threadId":"custom"}`)
+	helperTestVerifyLimitedValue(t, event["data"], "key", `"value"`)
+	for _, key := range []string{"requestId", "line", "logger"} {
+		if _, ok := event["context"][key]; ok {
+			t.Errorf("Expected %s to be relocated from context %v", key, event["context"])
+		}
+	}
+	if v := event["context"]["class"]; v != "Widget" {
+		t.Errorf("Expected class to remain in context %v", event["context"])
+	}
+	if v := event["context"]["threadId"]; v == "custom" || v == nil {
+		t.Errorf("Expected injected threadId in context %v", event["context"])
+	}
+}
+
+func TestFormatterStrictContextEmptyObjectName(t *testing.T) {
+	t.Parallel()
+	var formatter *Formatter = NewFormatter()
+	formatter.SetStrictContext(true)
+	formatter.SetRelocatedContextName("")
+	logger, buffer := HelperTestGetLogger("TestFormatterStrictContextEmptyObjectName", logrus.DebugLevel, formatter)
+	logger.InfoBuilder().
+			SetMessage("TestFormatterStrictContextEmptyObjectName").
+			AddContext("requestId", "abc").
+			Log()
+	HelperTestValidate(t, buffer.Bytes())
+	var event map[string]map[string]interface{}
+	helperTestUnmarshalBlocks(t, buffer.Bytes(), &event)
+	helperTestVerifyLimitedValue(t, event["data"], "context", `{"requestId":"abc"}`)
+	if _, ok := event["data"][""]; ok {
+		t.Errorf("Expected no data with an empty key %s", buffer.String())
+	}
+}
+
+func TestFormatterStrictContextPrefix(t *testing.T) {
+	t.Parallel()
+	var formatter *Formatter = NewFormatter()
+	formatter.SetStrictContext(true)
+	formatter.SetContextRelocation(ContextRelocationPrefix)
+	formatter.SetRelocatedContextName("ctx")
+	logger, buffer := HelperTestGetLogger("TestFormatterStrictContextPrefix", logrus.DebugLevel, formatter)
+	logger.InfoBuilder().
+			SetMessage("TestFormatterStrictContextPrefix").
+			AddData("ctx.conflict", "data").
+			AddContext("requestId", "abc").
+			AddContext("conflict", "context").
+			Log()
+	HelperTestValidate(t, buffer.Bytes())
+	var event map[string]map[string]interface{}
+	helperTestUnmarshalBlocks(t, buffer.Bytes(), &event)
+	helperTestVerifyLimitedValue(t, event["data"], "ctx.requestId", `"abc"`)
+	helperTestVerifyLimitedValue(t, event["data"], "ctx.conflict", `"data"`)
+	helperTestVerifyLimitedValue(t, event["data"], "_ctx.conflict", `"context"`)
+	if bytes.Count(buffer.Bytes(), []byte(`"ctx.conflict"`)) != 1 {
+		t.Errorf("Expected data to take precedence over relocated context %s", buffer.String())
+	}
+	if v := formatter.ErrorCount(); v != 1 {
+		t.Errorf("Incorrect number of relocation conflicts reported %v", v)
+	}
+
+	formatter.SetRelocatedContextName("")
+	buffer.Reset()
+	logger.InfoBuilder().
+			SetMessage("TestFormatterStrictContextPrefix").
+			AddContext("requestId", "abc").
+			AddContext("message", "context").
+			Log()
+	HelperTestValidate(t, buffer.Bytes())
+	helperTestUnmarshalBlocks(t, buffer.Bytes(), &event)
+	helperTestVerifyLimitedValue(t, event["data"], "requestId", `"abc"`)
+	helperTestVerifyLimitedValue(t, event["data"], "message", `"TestFormatterStrictContextPrefix"`)
+
+	buffer.Reset()
+	logger.InfoBuilder().
+			AddData("a", "data").
+			AddData("_a", "data").
+			AddContext("a", "context").
+			AddContext("_a", "context").
+			Log()
+	helperTestUnmarshalBlocks(t, buffer.Bytes(), &event)
+	helperTestVerifyLimitedValue(t, event["data"], "a", `"data"`)
+	helperTestVerifyLimitedValue(t, event["data"], "_a", `"data"`)
+	if len(event["data"]) != 4 || event["data"]["__a"] != "context" || event["data"]["___a"] != "context" {
+		t.Errorf("Expected renamed relocated context %v", event["data"])
+	}
+}
+
+func TestFormatterStrictContextObjectConflict(t *testing.T) {
+	t.Parallel()
+	var formatter *Formatter = NewFormatter()
+	formatter.SetStrictContext(true)
+	logger, buffer := HelperTestGetLogger("TestFormatterStrictContextObjectConflict", logrus.DebugLevel, formatter)
+	var failures []*FormatError
+	formatter.SetErrorHandler(func(err error, e *logrus.Entry) {
+		failures = append(failures, err.(*FormatError))
+	})
+	logger.InfoBuilder().
+			SetMessage("TestFormatterStrictContextObjectConflict").
+			AddData("context", "data").
+			AddData("_context", "data").
+			AddContext("requestId", "abc").
+			Log()
+	HelperTestValidate(t, buffer.Bytes())
+	var event map[string]map[string]interface{}
+	helperTestUnmarshalBlocks(t, buffer.Bytes(), &event)
+	helperTestVerifyLimitedValue(t, event["data"], "context", `"data"`)
+	helperTestVerifyLimitedValue(t, event["data"], "_context", `"data"`)
+	helperTestVerifyLimitedValue(t, event["data"], "__context", `{"requestId":"abc"}`)
+	if len(failures) != 1 || failures[0].Block != "context" {
+		t.Errorf("Incorrect relocation conflicts reported %v", failures)
+	}
+
+	buffer.Reset()
+	logger.InfoBuilder().(DataLogBuilder).
+			SetDataJSON([]byte(`{"context":"raw"}`)).
+			SetMessage("TestFormatterStrictContextObjectConflict").
+			AddContext("requestId", "abc").
+			Log()
+	HelperTestValidate(t, buffer.Bytes())
+	helperTestUnmarshalBlocks(t, buffer.Bytes(), &event)
+	helperTestVerifyLimitedValue(t, event["data"], "context", `"raw"`)
+	helperTestVerifyLimitedValue(t, event["data"], "_context", `{"requestId":"abc"}`)
+
+	buffer.Reset()
+	logger.InfoBuilder().SetMessage("TestFormatterStrictContextObjectConflict").Log()
+	if !bytes.Contains(buffer.Bytes(), []byte(`"data":{"message":"TestFormatterStrictContextObjectConflict"}`)) {
+		t.Errorf("Expected no relocated context object %s", buffer.String())
+	}
+}
+
+func TestFormatterLenientContext(t *testing.T) {
+	t.Parallel()
+	var formatter *Formatter = NewFormatter()
+	if formatter.StrictContext() {
+		t.Error("Expected lenient context by default")
+	}
+	logger, buffer := HelperTestGetLogger("TestFormatterLenientContext", logrus.DebugLevel, formatter)
+	logger.InfoBuilder().SetMessage("TestFormatterLenientContext").AddContext("requestId", "abc").Log()
+	var event map[string]map[string]interface{}
+	helperTestUnmarshalBlocks(t, buffer.Bytes(), &event)
+	if v := event["context"]["requestId"]; v != "abc" {
+		t.Errorf("Expected requestId in context %v", event["context"])
+	}
+	if _, ok := event["data"]["context"]; ok {
+		t.Errorf("Unexpected relocated context %v", event["data"])
+	}
+}
@@ -0,0 +1,36 @@
+//go:build go1.7
+// +build go1.7
+
+/*
+Copyright 2016 Ville Koskela
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gosteno
+
+import (
+	"runtime"
+)
+
+// Invoke the function with the frames of the program counters returned by runtime.Callers, including inlined frames,
+// until it returns false.
+func walkFrames(pcs []uintptr, f func(frame stackFrame) bool) {
+	var frames *runtime.Frames = runtime.CallersFrames(pcs)
+	for {
+		frame, more := frames.Next()
+		if !f(stackFrame{function: frame.Function, file: frame.File, line: frame.Line}) || !more {
+			return
+		}
+	}
+}
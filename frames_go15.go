@@ -0,0 +1,40 @@
+//go:build !go1.7
+// +build !go1.7
+
+/*
+Copyright 2016 Ville Koskela
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gosteno
+
+import (
+	"runtime"
+)
+
+// Invoke the function with the frames of the program counters returned by runtime.Callers until it returns false;
+// runtime.CallersFrames is not available and so inlined frames are not resolved.
+func walkFrames(pcs []uintptr, f func(frame stackFrame) bool) {
+	for _, pc := range pcs {
+		var frame stackFrame
+		// The program counter is the return address; the call is the instruction preceding it
+		if function := runtime.FuncForPC(pc - 1); function != nil {
+			frame.function = function.Name()
+			frame.file, frame.line = function.FileLine(pc - 1)
+		}
+		if !f(frame) {
+			return
+		}
+	}
+}
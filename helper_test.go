@@ -95,6 +95,31 @@ func HelperTestVerifyIgnoreContext(t *testing.T, actualBuffer *bytes.Buffer, act
 	}
 }
 
+// Verify the document is valid steno.
+func HelperTestValidate(t *testing.T, document []byte) {
+	result, err := gojsonschema.Validate(stenoSchemaLoader, gojsonschema.NewBytesLoader(document))
+	if err != nil {
+		t.Errorf("Validation against json schema failed because %v", err)
+	} else if !result.Valid() {
+		t.Errorf("Actual log message is not valid steno because %v actual is %s", result.Errors(), string(document))
+	}
+}
+
+// Verify the actual log message is byte-for-byte identical to the expected file (excluding the trailing new line).
+func HelperTestVerifyExact(t *testing.T, actualBuffer *bytes.Buffer, actualFile string) {
+	var err error
+	var expectedBuffer []byte
+	if expectedBuffer, err = ioutil.ReadFile(actualFile); err != nil {
+		t.Errorf("Failed to read actual file %s", actualFile)
+		return
+	}
+	var actualAsByteArray []byte = bytes.TrimSuffix(actualBuffer.Bytes(), []byte("\n"))
+	if !bytes.Equal(expectedBuffer, actualAsByteArray) {
+		t.Errorf("Actual log message does not match expected exactly; expected is %s but actual was %s", string(expectedBuffer), string(actualAsByteArray))
+		return
+	}
+}
+
 func hideIgnoredKeys(r map[string]interface{}, ignoreContextKeys []string) {
 	if node, ok := r["context"].(map[string]interface{}); ok {
 		for i := range ignoreContextKeys {
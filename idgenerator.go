@@ -0,0 +1,207 @@
+/*
+Copyright 2016 Ville Koskela
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package gosteno
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+	"github.com/pborman/uuid"
+	"github.com/Sirupsen/logrus"
+)
+
+const (
+	crockfordBase32 = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+)
+
+var (
+	_ IdGenerator = (*RandomIdGenerator)(nil)
+	_ IdGenerator = (*UUIDv7IdGenerator)(nil)
+	_ IdGenerator = (*ULIDIdGenerator)(nil)
+	_ IdGenerator = (*SequenceIdGenerator)(nil)
+	_ IdGenerator = (*NoIdGenerator)(nil)
+)
+
+// IdGenerator interface for generating event identifiers.
+type IdGenerator interface {
+
+	// Append the identifier for the event to dst; appending nothing omits the identifier from the event.
+	AppendId(dst []byte, e *logrus.Entry) []byte
+}
+
+// RandomIdGenerator generates random (version 4) UUIDs. This is the default.
+type RandomIdGenerator struct {
+}
+
+func NewRandomIdGenerator() *RandomIdGenerator {
+	return &RandomIdGenerator{}
+}
+
+func (rig *RandomIdGenerator) AppendId(dst []byte, e *logrus.Entry) []byte {
+	return append(dst, uuid.New()...)
+}
+
+// UUIDv7IdGenerator generates time-ordered (version 7) UUIDs from the event time. Identifiers generated within the
+// same millisecond are ordered by a counter.
+type UUIDv7IdGenerator struct {
+	mutex sync.Mutex
+	lastMillis int64
+	sequence uint16
+}
+
+func NewUUIDv7IdGenerator() *UUIDv7IdGenerator {
+	return &UUIDv7IdGenerator{}
+}
+
+func (uig *UUIDv7IdGenerator) AppendId(dst []byte, e *logrus.Entry) []byte {
+	var millis int64 = getIdMillis(e)
+	uig.mutex.Lock()
+	if millis <= uig.lastMillis {
+		// Preserve order within (or when the clock moves backwards before) the last millisecond
+		millis = uig.lastMillis
+		uig.sequence++
+		if uig.sequence > 0xFFF {
+			millis++
+			uig.sequence = 0
+		}
+	} else {
+		uig.sequence = uint16(randomUint64() & 0x7FF)
+	}
+	uig.lastMillis = millis
+	var sequence uint16 = uig.sequence
+	uig.mutex.Unlock()
+
+	var id [16]byte
+	binary.BigEndian.PutUint64(id[8:], randomUint64())
+	binary.BigEndian.PutUint64(id[0:], uint64(millis) << 16)
+	id[6] = 0x70 | byte(sequence >> 8)
+	id[7] = byte(sequence)
+	id[8] = 0x80 | (id[8] & 0x3F)
+	return appendUUID(dst, id)
+}
+
+// ULIDIdGenerator generates time-ordered ULIDs (https://github.com/ulid/spec) from the event time. Identifiers
+// generated within the same millisecond are ordered by incrementing the random component.
+type ULIDIdGenerator struct {
+	mutex sync.Mutex
+	lastMillis int64
+	entropyHigh uint16
+	entropyLow uint64
+}
+
+func NewULIDIdGenerator() *ULIDIdGenerator {
+	return &ULIDIdGenerator{}
+}
+
+func (uig *ULIDIdGenerator) AppendId(dst []byte, e *logrus.Entry) []byte {
+	var millis int64 = getIdMillis(e)
+	uig.mutex.Lock()
+	if millis <= uig.lastMillis {
+		// Preserve order within (or when the clock moves backwards before) the last millisecond
+		millis = uig.lastMillis
+		uig.entropyLow++
+		if uig.entropyLow == 0 {
+			uig.entropyHigh++
+		}
+	} else {
+		uig.entropyHigh = uint16(randomUint64())
+		uig.entropyLow = randomUint64()
+	}
+	uig.lastMillis = millis
+	var entropyHigh uint16 = uig.entropyHigh
+	var entropyLow uint64 = uig.entropyLow
+	uig.mutex.Unlock()
+
+	var id [16]byte
+	binary.BigEndian.PutUint64(id[0:], uint64(millis) << 16 | uint64(entropyHigh))
+	binary.BigEndian.PutUint64(id[8:], entropyLow)
+
+	// Encode the 128 bits as 26 characters of 5 bits each; the first character carries the 3 most significant bits
+	var high uint64 = binary.BigEndian.Uint64(id[0:])
+	var low uint64 = binary.BigEndian.Uint64(id[8:])
+	var encoded [26]byte
+	for i := 25; i >= 0; i-- {
+		encoded[i] = crockfordBase32[low & 0x1F]
+		low = low >> 5 | high << 59
+		high >>= 5
+	}
+	return append(dst, encoded[:]...)
+}
+
+// SequenceIdGenerator generates identifiers composed of a random per-generator prefix and a counter (e.g.
+// 5f7acb89c4984b30-42). These are inexpensive to generate and ordered within the process but not across processes.
+type SequenceIdGenerator struct {
+	// First such that it is 64-bit aligned for atomic access on 32-bit platforms
+	counter uint64
+	prefix string
+}
+
+func NewSequenceIdGenerator() *SequenceIdGenerator {
+	var prefix []byte = strconv.AppendUint(nil, randomUint64(), 16)
+	for len(prefix) < 16 {
+		prefix = append([]byte{'0'}, prefix...)
+	}
+	return &SequenceIdGenerator{prefix: string(prefix) + "-"}
+}
+
+func (sig *SequenceIdGenerator) AppendId(dst []byte, e *logrus.Entry) []byte {
+	dst = append(dst, sig.prefix...)
+	return strconv.AppendUint(dst, atomic.AddUint64(&sig.counter, 1), 10)
+}
+
+// NoIdGenerator omits the identifier from events.
+type NoIdGenerator struct {
+}
+
+func NewNoIdGenerator() *NoIdGenerator {
+	return &NoIdGenerator{}
+}
+
+func (nig *NoIdGenerator) AppendId(dst []byte, e *logrus.Entry) []byte {
+	return dst
+}
+
+// The event time in milliseconds since the epoch; the current time if the event time is not set.
+func getIdMillis(e *logrus.Entry) int64 {
+	var t time.Time = getEntryTime(e)
+	if t.IsZero() {
+		return unixMillis(time.Now())
+	}
+	return unixMillis(t)
+}
+
+// Random bits from crypto/rand; the current time if it fails.
+func randomUint64() uint64 {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return uint64(time.Now().UnixNano())
+	}
+	return binary.BigEndian.Uint64(b[:])
+}
+
+// Append the canonical text form of the UUID (e.g. 0190b5a1-4c1e-7b2a-9c3d-5e6f7a8b9c0d).
+func appendUUID(dst []byte, id [16]byte) []byte {
+	for i, b := range id {
+		if i == 4 || i == 6 || i == 8 || i == 10 {
+			dst = append(dst, '-')
+		}
+		dst = append(dst, hexDigits[b >> 4], hexDigits[b & 0xF])
+	}
+	return dst
+}
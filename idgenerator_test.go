@@ -0,0 +1,121 @@
+/*
+Copyright 2016 Ville Koskela
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package gosteno
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"testing"
+	"time"
+	"github.com/Sirupsen/logrus"
+)
+
+type testQuotingIdGenerator struct {
+}
+
+func (tqig *testQuotingIdGenerator) AppendId(dst []byte, e *logrus.Entry) []byte {
+	return append(dst, "\"quoted\""...)
+}
+
+func TestRandomIdGenerator(t *testing.T) {
+	t.Parallel()
+	helperTestIdGenerator(t, NewRandomIdGenerator(), `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`, false)
+}
+
+func TestUUIDv7IdGenerator(t *testing.T) {
+	t.Parallel()
+	helperTestIdGenerator(t, NewUUIDv7IdGenerator(), `^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`, true)
+	var id string = string(NewUUIDv7IdGenerator().AppendId(nil, &logrus.Entry{Time: time.Unix(0, 0x0190b5a14c1e * int64(time.Millisecond))}))
+	if id[:13] != "0190b5a1-4c1e" {
+		t.Errorf("Incorrect timestamp in %s", id)
+	}
+}
+
+func TestULIDIdGenerator(t *testing.T) {
+	t.Parallel()
+	helperTestIdGenerator(t, NewULIDIdGenerator(), `^[0-7][0-9A-HJKMNP-TV-Z]{25}$`, true)
+	var id string = string(NewULIDIdGenerator().AppendId(nil, &logrus.Entry{Time: time.Unix(0, 1469918176385 * int64(time.Millisecond))}))
+	if id[:10] != "01ARYZ6S41" {
+		t.Errorf("Incorrect timestamp in %s", id)
+	}
+}
+
+func TestSequenceIdGenerator(t *testing.T) {
+	t.Parallel()
+	var generator *SequenceIdGenerator = NewSequenceIdGenerator()
+	helperTestIdGenerator(t, generator, `^[0-9a-f]{16}-[0-9]+$`, false)
+	var first string = string(generator.AppendId(nil, emptyEntry))
+	var second string = string(generator.AppendId(nil, emptyEntry))
+	if first[:17] != second[:17] || first == second {
+		t.Errorf("Incorrect sequence %s followed by %s", first, second)
+	}
+}
+
+func TestFormatterIdGenerator(t *testing.T) {
+	t.Parallel()
+	var formatter *Formatter = NewFormatter()
+	formatter.SetIdGenerator(NewULIDIdGenerator())
+	logger, buffer := HelperTestGetLogger("TestFormatterIdGenerator", logrus.DebugLevel, formatter)
+	logger.DebugBuilder().SetMessage("TestFormatterIdGenerator").Log()
+	HelperTestVerify(t, buffer, formatterTestDataPath + "TestFormatterIdGenerator.expected.json")
+}
+
+func TestFormatterNoIdGenerator(t *testing.T) {
+	t.Parallel()
+	var formatter *Formatter = NewFormatter()
+	formatter.SetIdGenerator(NewNoIdGenerator())
+	logger, buffer := HelperTestGetLogger("TestFormatterNoIdGenerator", logrus.DebugLevel, formatter)
+	logger.DebugBuilder().SetMessage("TestFormatterNoIdGenerator").Log()
+	HelperTestVerify(t, buffer, formatterTestDataPath + "TestFormatterNoIdGenerator.expected.json")
+}
+
+func TestFormatterEscapedIdGenerator(t *testing.T) {
+	t.Parallel()
+	var formatter *Formatter = NewFormatter()
+	formatter.SetIdGenerator(new(testQuotingIdGenerator))
+	logger, buffer := HelperTestGetLogger("TestFormatterEscapedIdGenerator", logrus.DebugLevel, formatter)
+	logger.DebugBuilder().SetMessage("TestFormatterEscapedIdGenerator").Log()
+	var event map[string]interface{}
+	if err := json.Unmarshal(buffer.Bytes(), &event); err != nil || event["id"] != "\"quoted\"" {
+		t.Errorf("Incorrect escaping of id in %s", buffer.String())
+	}
+}
+
+func helperTestIdGenerator(t *testing.T, generator IdGenerator, pattern string, ordered bool) {
+	var entry *logrus.Entry = &logrus.Entry{Time: time.Now()}
+	var previous []byte
+	for i := 0; i < 10000; i++ {
+		if i % 1000 == 0 {
+			entry.Time = entry.Time.Add(time.Millisecond)
+		}
+		var id []byte = generator.AppendId(nil, entry)
+		if !regexp.MustCompile(pattern).Match(id) {
+			t.Fatalf("Id %s does not match %s", id, pattern)
+		}
+		if ordered && bytes.Compare(previous, id) >= 0 {
+			t.Fatalf("Id %s is not ordered after %s", id, previous)
+		}
+		previous = id
+	}
+}
+
+func BenchmarkFormatterUUIDv7Id(b *testing.B) {
+	var formatter *Formatter = NewFormatter()
+	formatter.SetIdGenerator(NewUUIDv7IdGenerator())
+	var entry *logrus.Entry = MarkerMaps.Encode(logrus.New(), "", "benchmark", map[string]interface{}{}, map[string]interface{}{}, nil)
+	helperBenchmarkFormat(b, formatter, entry)
+}
@@ -0,0 +1,230 @@
+/*
+Copyright 2016 Ville Koskela
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package gosteno
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"github.com/Sirupsen/logrus"
+)
+
+const (
+	EVENT_DATA_DATA_JSON_KEY string = "dataJson"
+	EVENT_DATA_CONTEXT_JSON_KEY string = "contextJson"
+
+	// The key of the placeholder replacing an invalid json object.
+	rawJsonErrorKey = "_json"
+)
+
+var (
+	_ Marker = (*JSONMarker)(nil)
+	_ RawMarker = (*JSONMarker)(nil)
+
+	errNotJsonObject = errors.New("invalid json: not an object")
+	errJsonAfterObject = errors.New("invalid json: content after object")
+)
+
+// RawMarker is an optional interface markers may implement to supply data and context as pre-serialized json objects;
+// the Formatter validates the objects and appends their members to the event instead of encoding the data and context
+// parsed with ParseData and ParseContext. The members are appended compacted but otherwise unchanged unless a redactor
+// or value limits are configured, in which case their values are decoded and encoded as other values.
+type RawMarker interface {
+
+	// Parse data from event as a json object (nil if none) and the data in addition to it.
+	ParseRawData(e *logrus.Entry) (json.RawMessage, map[string]interface{})
+
+	// Parse context from event as a json object (nil if none) and the context in addition to it.
+	ParseRawContext(e *logrus.Entry) (json.RawMessage, map[string]interface{})
+}
+
+// JSON marker implementation; data and context are supplied as pre-serialized json objects in addition to maps. The
+// members of the objects precede those of the maps which take precedence for the same key.
+type JSONMarker struct { }
+
+// Encode.
+func (sjm *JSONMarker) Encode(
+		logger *logrus.Logger,
+		event string,
+		loggerName string,
+		dataJson json.RawMessage,
+		data map[string]interface{},
+		contextJson json.RawMessage,
+		context map[string]interface{},
+		err error) *logrus.Entry {
+
+	var s stack
+	if err != nil {
+		s = captureStack(1)
+	}
+	return sjm.encode(logger, event, loggerName, dataJson, data, contextJson, context, err, s)
+}
+
+func (sjm *JSONMarker) encode(
+		logger *logrus.Logger,
+		event string,
+		loggerName string,
+		dataJson json.RawMessage,
+		data map[string]interface{},
+		contextJson json.RawMessage,
+		context map[string]interface{},
+		err error,
+		s stack) *logrus.Entry {
+
+	var entry *logrus.Entry = logrus.NewEntry(logger).WithFields(logrus.Fields{
+		MarkerKey: sjm,
+		EVENT_DATA_EVENT_KEY: event,
+		EVENT_DATA_LOGGER_KEY: loggerName,
+		EVENT_DATA_DATA_JSON_KEY: dataJson,
+		EVENT_DATA_DATA_KEY: data,
+		EVENT_DATA_CONTEXT_JSON_KEY: contextJson,
+		EVENT_DATA_CONTEXT_KEY: context,
+		EVENT_DATA_ERROR_KEY: err,})
+	if s != nil {
+		entry.Data[StackKey] = s
+	}
+	return entry
+}
+
+// Parse event name from event.
+func (sjm *JSONMarker) ParseEvent(e *logrus.Entry) string {
+	v, _ := e.Data[EVENT_DATA_EVENT_KEY].(string)
+	return v
+}
+
+// Parse logger name from event.
+func (sjm *JSONMarker) ParseLoggerName(e *logrus.Entry) string {
+	v, _ := e.Data[EVENT_DATA_LOGGER_KEY].(string)
+	return v
+}
+
+// Parse data from event; the json object is decoded and merged with the data. This is provided for consumers other
+// than the Formatter (e.g. the ConsoleFormatter).
+func (sjm *JSONMarker) ParseData(e *logrus.Entry) map[string]interface{} {
+	return decodeJsonObject(sjm.ParseRawData(e))
+}
+
+// Parse context from event; the json object is decoded and merged with the context.
+func (sjm *JSONMarker) ParseContext(e *logrus.Entry) map[string]interface{} {
+	return decodeJsonObject(sjm.ParseRawContext(e))
+}
+
+// Parse error from event.
+func (sjm *JSONMarker) ParseError(e *logrus.Entry) error {
+	v, _ := e.Data[EVENT_DATA_ERROR_KEY].(error)
+	return v
+}
+
+// Parse data from event as a json object and the data in addition to it.
+func (sjm *JSONMarker) ParseRawData(e *logrus.Entry) (json.RawMessage, map[string]interface{}) {
+	raw, _ := e.Data[EVENT_DATA_DATA_JSON_KEY].(json.RawMessage)
+	data, _ := e.Data[EVENT_DATA_DATA_KEY].(map[string]interface{})
+	return raw, data
+}
+
+// Parse context from event as a json object and the context in addition to it.
+func (sjm *JSONMarker) ParseRawContext(e *logrus.Entry) (json.RawMessage, map[string]interface{}) {
+	raw, _ := e.Data[EVENT_DATA_CONTEXT_JSON_KEY].(json.RawMessage)
+	context, _ := e.Data[EVENT_DATA_CONTEXT_KEY].(map[string]interface{})
+	return raw, context
+}
+
+// Decode the json object merged with the values; the values take precedence. An invalid object is replaced by the
+// same placeholder as written by the Formatter.
+func decodeJsonObject(raw json.RawMessage, values map[string]interface{}) map[string]interface{} {
+	var result map[string]interface{} = make(map[string]interface{}, len(values))
+	if len(raw) > 0 {
+		var err error = walkJsonMembers(raw, func(key string, value json.RawMessage) {})
+		if err == nil {
+			var decoder *json.Decoder = json.NewDecoder(bytes.NewReader(raw))
+			decoder.UseNumber()
+			err = decoder.Decode(&result)
+		}
+		if err != nil {
+			result = map[string]interface{}{rawJsonErrorKey: placeholder(err)}
+		}
+	}
+	for key, value := range values {
+		result[key] = value
+	}
+	return result
+}
+
+// Invoke the function with the key and value of each member of the json object in order; a failure, including content
+// following the object, is returned after the members preceding it.
+func walkJsonMembers(object json.RawMessage, f func(key string, value json.RawMessage)) error {
+	var decoder *json.Decoder = json.NewDecoder(bytes.NewReader(object))
+	token, err := decoder.Token()
+	if err != nil {
+		return invalidJsonError(err)
+	}
+	if delimiter, ok := token.(json.Delim); !ok || delimiter != '{' {
+		return errNotJsonObject
+	}
+	for decoder.More() {
+		if token, err = decoder.Token(); err != nil {
+			return invalidJsonError(err)
+		}
+		var value json.RawMessage
+		if err = decoder.Decode(&value); err != nil {
+			return invalidJsonError(err)
+		}
+		f(token.(string), value)
+	}
+	if _, err = decoder.Token(); err != nil {
+		return invalidJsonError(err)
+	}
+	if _, err = decoder.Token(); err != io.EOF {
+		if err == nil {
+			return errJsonAfterObject
+		}
+		return invalidJsonError(err)
+	}
+	return nil
+}
+
+// Decode the valid json value with numbers decoded as json.Number such that they are encoded unchanged.
+func decodeJsonValue(raw json.RawMessage) interface{} {
+	var decoder *json.Decoder = json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return raw
+	}
+	return value
+}
+
+func invalidJsonError(err error) error {
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return errors.New("invalid json: " + err.Error())
+}
+
+// Append the json value compacted; an invalid value is replaced by a placeholder and the failure returned.
+func appendRawJsonValue(dst []byte, value json.RawMessage) ([]byte, error) {
+	if value == nil {
+		return append(dst, "null"...), nil
+	}
+	var start int = len(dst)
+	var buffer *bytes.Buffer = bytes.NewBuffer(dst)
+	if err := json.Compact(buffer, value); err != nil {
+		err = errors.New("invalid json: " + err.Error())
+		return append(dst[:start], marshalPlaceholder(err)...), err
+	}
+	return buffer.Bytes(), nil
+}
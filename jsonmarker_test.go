@@ -0,0 +1,205 @@
+/*
+Copyright 2016 Ville Koskela
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package gosteno
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"github.com/Sirupsen/logrus"
+)
+
+func TestJSONMarkerParse(t *testing.T) {
+	t.Parallel()
+	var jm *JSONMarker = new(JSONMarker)
+	var e *logrus.Entry = jm.Encode(
+		logger,
+		"my_event",
+		"my_logger",
+		json.RawMessage(`{"a":1,"b":"raw"}`),
+		map[string]interface{}{"b": "explicit"},
+		json.RawMessage(`[1]`),
+		map[string]interface{}{"c": true},
+		nil)
+	var expectedData map[string]interface{} = map[string]interface{}{"a": json.Number("1"), "b": "explicit"}
+	if v := jm.ParseData(e); !reflect.DeepEqual(v, expectedData) {
+		t.Errorf("ParseData failed; expected '%v' instead actual '%v'", expectedData, v)
+	}
+	var expectedContext map[string]interface{} = map[string]interface{}{
+		"_json": "<error: invalid json: not an object>",
+		"c": true,
+	}
+	if v := jm.ParseContext(e); !reflect.DeepEqual(v, expectedContext) {
+		t.Errorf("ParseContext failed; expected '%v' instead actual '%v'", expectedContext, v)
+	}
+	if v := jm.ParseEvent(e); v != "my_event" {
+		t.Errorf("ParseEvent failed %s", v)
+	}
+	if v := jm.ParseLoggerName(e); v != "my_logger" {
+		t.Errorf("ParseLoggerName failed %s", v)
+	}
+	if v := jm.ParseData(emptyEntry); len(v) != 0 {
+		t.Errorf("ParseData failed; expected empty instead actual '%v'", v)
+	}
+}
+
+func TestJSONMarkerParseContentAfterObject(t *testing.T) {
+	t.Parallel()
+	var jm *JSONMarker = new(JSONMarker)
+	var e *logrus.Entry = jm.Encode(logger, "", "", json.RawMessage(`{"a":1} {"b":2}`), nil, nil, nil, nil)
+	var expectedData map[string]interface{} = map[string]interface{}{"_json": "<error: invalid json: content after object>"}
+	if v := jm.ParseData(e); !reflect.DeepEqual(v, expectedData) {
+		t.Errorf("ParseData failed; expected '%v' instead actual '%v'", expectedData, v)
+	}
+}
+
+func TestFormatterDataJSON(t *testing.T) {
+	t.Parallel()
+	var formatter *Formatter = NewFormatter()
+	logger, buffer := HelperTestGetLogger("TestFormatterDataJSON", logrus.DebugLevel, formatter)
+	var tests []struct {
+		message string
+		json string
+		expected string
+	} = []struct {
+		message string
+		json string
+		expected string
+	}{
+		{"M", "{\n  \"a\": 1,\n  \"b\": {\"c\": [1, 2], \"d\": \"<&>\"}\n}", `"data":{"message":"M","a":1,"b":{"c":[1,2],"d":"<&>"},"extra":true}`},
+		{"", `{"a":1}`, `"data":{"a":1,"extra":true}`},
+		{"M", ` {} `, `"data":{"message":"M","extra":true}`},
+		{"M", `{"a":}`, `"data":{"message":"M","_json":"\u003cerror: invalid json: invalid character '}' looking for beginning of value\u003e","extra":true}`},
+		{"M", `[1,2]`, `"data":{"message":"M","_json":"\u003cerror: invalid json: not an object\u003e","extra":true}`},
+	}
+	for _, test := range tests {
+		buffer.Reset()
+		logger.InfoBuilder().(DataLogBuilder).SetDataJSON([]byte(test.json)).SetMessage(test.message).AddData("extra", true).Log()
+		if !strings.Contains(buffer.String(), test.expected) {
+			t.Errorf("Incorrect data for %s; expected %s in %s", test.json, test.expected, buffer.String())
+		}
+		HelperTestValidate(t, buffer.Bytes())
+	}
+	if v := formatter.ErrorCount(); v != 2 {
+		t.Errorf("Incorrect error count %v", v)
+	}
+}
+
+func TestFormatterDataJSONDuplicateKeys(t *testing.T) {
+	t.Parallel()
+	var formatter *Formatter = NewFormatter()
+	logger, buffer := HelperTestGetLogger("TestFormatterDataJSONDuplicateKeys", logrus.DebugLevel, formatter)
+	logger.InfoBuilder().(DataLogBuilder).
+			SetDataJSON([]byte(`{"message":"duplicate","a":"raw","b":2}`)).
+			SetMessage("TestFormatterDataJSONDuplicateKeys").
+			AddData("a", "explicit").
+			Log()
+	if !strings.Contains(buffer.String(), `"data":{"message":"TestFormatterDataJSONDuplicateKeys","b":2,"a":"explicit"}`) {
+		t.Errorf("Incorrect data with duplicate keys %s", buffer.String())
+	}
+	buffer.Reset()
+	logger.InfoBuilder().(DataLogBuilder).SetDataJSON([]byte(`{"message":"raw"}`)).Log()
+	if !strings.Contains(buffer.String(), `"data":{"message":"raw"}`) {
+		t.Errorf("Incorrect data with message only in json %s", buffer.String())
+	}
+}
+
+func TestFormatterDataJSONRedactionAndLimits(t *testing.T) {
+	t.Parallel()
+	var formatter *Formatter = NewFormatter()
+	var redactor *Redactor = NewRedactor()
+	redactor.AddKey("password", RedactionModeMask)
+	redactor.AddKey("token", RedactionModeDrop)
+	formatter.SetRedactor(redactor)
+	formatter.SetMaxStringLength(4)
+	formatter.SetMaxElements(2)
+	logger, buffer := HelperTestGetLogger("TestFormatterDataJSONRedactionAndLimits", logrus.DebugLevel, formatter)
+	logger.InfoBuilder().(DataLogBuilder).
+			SetDataJSON([]byte(`{"password":"p","token":"t","user":{"password":"q","name":"alice"},"list":[1,2,3],"n":1.50}`)).
+			AddDataRaw("raw", json.RawMessage(`{"password":"r","name":"bobby"}`)).
+			SetMessage("M").
+			Log()
+	var expected string = `"data":{"message":"M","password":"***","user":{"name":"alic...(truncated 1 bytes)","password":"***"},` +
+			`"list":[1,2,"...(truncated 1 elements)"],"n":1.50,"raw":{"name":"bobb...(truncated 1 bytes)","password":"***"}}`
+	if !strings.Contains(buffer.String(), expected) {
+		t.Errorf("Incorrect redacted and limited data; expected %s in %s", expected, buffer.String())
+	}
+	HelperTestValidate(t, buffer.Bytes())
+}
+
+func TestFormatterAddDataRaw(t *testing.T) {
+	t.Parallel()
+	var formatter *Formatter = NewFormatter()
+	var failures []*FormatError
+	formatter.SetErrorHandler(func(err error, e *logrus.Entry) {
+		failures = append(failures, err.(*FormatError))
+	})
+	logger, buffer := HelperTestGetLogger("TestFormatterAddDataRaw", logrus.DebugLevel, formatter)
+	logger.InfoBuilder().(DataLogBuilder).
+			AddDataRaw("valid", json.RawMessage("[1, {\"a\" :\n \"<b>\"}]")).
+			SetMessage("TestFormatterAddDataRaw").
+			Log()
+	if !strings.Contains(buffer.String(), `"valid":[1,{"a":"<b>"}]`) {
+		t.Errorf("Incorrect raw data %s", buffer.String())
+	}
+	buffer.Reset()
+	logger.InfoBuilder().(DataLogBuilder).AddDataRaw("invalid", json.RawMessage(`{`)).SetMessage("TestFormatterAddDataRaw").Log()
+	if !strings.Contains(buffer.String(), `"invalid":"\u003cerror: invalid json: unexpected end of JSON input\u003e"`) {
+		t.Errorf("Incorrect invalid raw data %s", buffer.String())
+	}
+	buffer.Reset()
+	logger.InfoBuilder().(DataLogBuilder).AddDataRaw("nil", nil).SetMessage("TestFormatterAddDataRaw").Log()
+	if !strings.Contains(buffer.String(), `"nil":null`) {
+		t.Errorf("Incorrect nil raw data %s", buffer.String())
+	}
+	if len(failures) != 1 || failures[0].Block != "data" || failures[0].Key != "invalid" {
+		t.Errorf("Incorrect failures reported %v", failures)
+	}
+}
+
+func TestFormatterContextJSON(t *testing.T) {
+	t.Parallel()
+	var formatter *Formatter = NewFormatter()
+	var buffer *bytes.Buffer = new(bytes.Buffer)
+	var logrusLogger *logrus.Logger = &logrus.Logger{
+		Out: buffer,
+		Formatter: formatter,
+		Level: logrus.DebugLevel,
+	}
+	var entry *logrus.Entry = MarkerJSON.Encode(
+		logrusLogger,
+		"my_event",
+		"my_logger",
+		nil,
+		nil,
+		json.RawMessage(`{"requestId":"abc"}`),
+		nil,
+		nil)
+	entry.Info("TestFormatterContextJSON")
+	if !strings.Contains(buffer.String(), `"context":{"requestId":"abc","host":`) {
+		t.Errorf("Incorrect raw context %s", buffer.String())
+	}
+
+	formatter.SetStrictContext(true)
+	buffer.Reset()
+	entry.Info("TestFormatterContextJSON")
+	HelperTestValidate(t, buffer.Bytes())
+	if !strings.Contains(buffer.String(), `"context":{"requestId":"abc"}`) {
+		t.Errorf("Incorrect relocated raw context %s", buffer.String())
+	}
+}
@@ -0,0 +1,66 @@
+/*
+Copyright 2016 Ville Koskela
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package gosteno
+
+import (
+	"fmt"
+	"reflect"
+)
+
+var (
+	lazyValueType = reflect.TypeOf((*LazyValue)(nil)).Elem()
+)
+
+// LazyValue is a data, context or exception data value that is evaluated only when the event is formatted; for
+// example, to avoid expensive computation for events that are never emitted. The function is evaluated each time the
+// event is formatted and a function panicking is isolated as a placeholder.
+type LazyValue func() interface{}
+
+// Lazy returns a value evaluated by the function only when the event is formatted.
+func Lazy(f func() interface{}) LazyValue {
+	return LazyValue(f)
+}
+
+// MarshalJSON evaluates the value; this supports lazy values nested within other values. A failure is isolated as a
+// placeholder of the nested value. When limits or a redactor are configured, nested lazy values are instead evaluated
+// by the formatter such that these apply to the value.
+func (lv LazyValue) MarshalJSON() ([]byte, error) {
+	value, err := resolveLazy(lv)
+	if err != nil {
+		return marshalPlaceholder(err), nil
+	}
+	jsonBytes, _ := marshalValue(value)
+	return jsonBytes, nil
+}
+
+// Evaluate the value if it is lazy; a function panicking is reported as a failure.
+func resolveLazy(value interface{}) (result interface{}, err error) {
+	var lazyValue LazyValue
+	var ok bool
+	if lazyValue, ok = value.(LazyValue); !ok {
+		return value, nil
+	}
+	if lazyValue == nil {
+		return nil, nil
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			result = nil
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return lazyValue(), nil
+}
@@ -0,0 +1,155 @@
+/*
+Copyright 2016 Ville Koskela
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package gosteno
+
+import (
+	"encoding/json"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"github.com/Sirupsen/logrus"
+)
+
+func TestLazyNotEvaluatedWhenSuppressed(t *testing.T) {
+	t.Parallel()
+	var evaluations int32
+	logger, buffer := HelperTestGetLogger("TestLazyNotEvaluatedWhenSuppressed", logrus.InfoLevel, NewFormatter())
+	logger.DebugBuilder().(DataLogBuilder).
+			AddDataFunc("dump", func() interface{} {
+				atomic.AddInt32(&evaluations, 1)
+				return "expensive"
+			}).
+			SetMessage("TestLazyNotEvaluatedWhenSuppressed").
+			Log()
+	logger.WithField("dump", Lazy(func() interface{} {
+		atomic.AddInt32(&evaluations, 1)
+		return "expensive"
+	})).Debug("TestLazyNotEvaluatedWhenSuppressed")
+	HelperTestVerifyEmpty(t, buffer)
+	if v := atomic.LoadInt32(&evaluations); v != 0 {
+		t.Errorf("Lazy value evaluated %d times for suppressed event", v)
+	}
+}
+
+func TestLazyEvaluatedWhenFormatted(t *testing.T) {
+	t.Parallel()
+	var evaluations int32
+	logger, buffer := HelperTestGetLogger("TestLazyEvaluatedWhenFormatted", logrus.DebugLevel, NewFormatter())
+	logger.InfoBuilder().(DataLogBuilder).
+			AddDataFunc("dump", func() interface{} {
+				atomic.AddInt32(&evaluations, 1)
+				return map[string]interface{}{"size": 42}
+			}).
+			SetMessage("TestLazyEvaluatedWhenFormatted").
+			AddData("nested", map[string]interface{}{"lazy": Lazy(func() interface{} { return "nested" })}).
+			AddData("none", LazyValue(nil)).
+			AddContext("requestId", Lazy(func() interface{} { return "3186ea94" })).
+			Log()
+	var event map[string]map[string]interface{}
+	helperTestUnmarshalBlocks(t, buffer.Bytes(), &event)
+	if v, ok := event["data"]["dump"].(map[string]interface{}); !ok || v["size"] != 42.0 {
+		t.Errorf("Incorrect lazy data %v", event["data"]["dump"])
+	}
+	if v, ok := event["data"]["nested"].(map[string]interface{}); !ok || v["lazy"] != "nested" {
+		t.Errorf("Incorrect nested lazy data %v", event["data"]["nested"])
+	}
+	if v, ok := event["data"]["none"]; !ok || v != nil {
+		t.Errorf("Incorrect nil lazy data %v", v)
+	}
+	if v := event["context"]["requestId"]; v != "3186ea94" {
+		t.Errorf("Incorrect lazy context %v", v)
+	}
+	if v := atomic.LoadInt32(&evaluations); v != 1 {
+		t.Errorf("Lazy value evaluated %d times", v)
+	}
+}
+
+func TestLazyPanic(t *testing.T) {
+	t.Parallel()
+	var formatter *Formatter = NewFormatter()
+	logger, buffer := HelperTestGetLogger("TestLazyPanic", logrus.DebugLevel, formatter)
+	logger.InfoBuilder().(DataLogBuilder).
+			AddDataFunc("dump", func() interface{} { panic("dump failure") }).
+			SetMessage("TestLazyPanic").
+			AddData("nested", []interface{}{Lazy(func() interface{} { panic("nested failure") })}).
+			Log()
+	var event map[string]map[string]interface{}
+	helperTestUnmarshalBlocks(t, buffer.Bytes(), &event)
+	if v := event["data"]["dump"]; v != "<error: panic: dump failure>" {
+		t.Errorf("Incorrect placeholder for panicking lazy data %v", v)
+	}
+	if v, ok := event["data"]["nested"].([]interface{}); !ok || len(v) != 1 || v[0] != "<error: panic: nested failure>" {
+		t.Errorf("Incorrect placeholder for panicking nested lazy data %v", event["data"]["nested"])
+	}
+	if v := formatter.ErrorCount(); v != 1 {
+		t.Errorf("Incorrect number of failures %v", v)
+	}
+}
+
+func TestLazyNestedLimitsAndRedaction(t *testing.T) {
+	t.Parallel()
+	var formatter *Formatter = NewFormatter()
+	var redactor *Redactor = NewRedactor()
+	redactor.AddKey("password", RedactionModeMask)
+	formatter.SetRedactor(redactor)
+	formatter.SetMaxStringLength(4)
+	logger, buffer := HelperTestGetLogger("TestLazyNestedLimitsAndRedaction", logrus.DebugLevel, formatter)
+	logger.InfoBuilder().
+			SetMessage("TestLazyNestedLimitsAndRedaction").
+			AddData("nested", map[string]interface{}{
+				"text": Lazy(func() interface{} { return "truncated" }),
+				"credentials": Lazy(func() interface{} { return map[string]string{"password": "hunter2"} }),
+				"failure": Lazy(func() interface{} { panic("nested failure") }),
+			}).
+			Log()
+	var event map[string]map[string]interface{}
+	helperTestUnmarshalBlocks(t, buffer.Bytes(), &event)
+	var expected string = `{"credentials":{"password":"***"},"failure":"<error: panic: nested failure>","text":"trun...(truncated 5 bytes)"}`
+	if actual := helperTestMarshalUnescaped(event["data"]["nested"]); actual != expected {
+		t.Errorf("Incorrect nested lazy data; expected %s but was %s", expected, actual)
+	}
+	if v := formatter.ErrorCount(); v != 1 {
+		t.Errorf("Incorrect number of failures %v", v)
+	}
+}
+
+func TestLazyConsoleFormatter(t *testing.T) {
+	t.Parallel()
+	logger, buffer := helperTestGetConsoleLogger("TestLazyConsoleFormatter", NewConsoleFormatter())
+	logger.InfoBuilder().(DataLogBuilder).
+			AddDataFunc("dump", func() interface{} { return 42 }).
+			SetMessage("TestLazyConsoleFormatter").
+			Log()
+	if !strings.Contains(buffer.String(), "dump = 42\n") {
+		t.Errorf("Incorrect lazy data in %s", buffer.String())
+	}
+}
+
+// Unmarshal the data and context blocks of the event.
+func helperTestUnmarshalBlocks(t *testing.T, document []byte, event *map[string]map[string]interface{}) {
+	var root map[string]json.RawMessage
+	if err := json.Unmarshal(document, &root); err != nil {
+		t.Fatalf("Unmarshal of actual failed because %v in buffer %s", err, string(document))
+	}
+	*event = make(map[string]map[string]interface{})
+	for _, block := range []string{"data", "context"} {
+		var values map[string]interface{}
+		if err := json.Unmarshal(root[block], &values); err != nil {
+			t.Fatalf("Unmarshal of %s failed because %v in buffer %s", block, err, string(document))
+		}
+		(*event)[block] = values
+	}
+}
@@ -0,0 +1,665 @@
+/*
+Copyright 2016 Ville Koskela
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package gosteno
+
+import (
+	"encoding"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	// Cache of the encoded fields by struct type.
+	structFieldsCache cacheMap
+
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	jsonNumberType = reflect.TypeOf((*json.Number)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// Limits applied when encoding a value; zero is unlimited.
+type valueLimits struct {
+	maxDepth int
+	maxElements int
+	maxStringLength int
+}
+
+// Encoder of values applying limits and replacing reference cycles. The encoding is otherwise consistent with
+// encoding/json (e.g. struct tags, omitempty, embedded structs and marshalers) but values failing to encode are
+// isolated as placeholders within the value.
+type limitedEncoder struct {
+	w *eventWriter
+	limits valueLimits
+	redactor *Redactor
+	encoders *encoderRegistry
+	path []cycleKey
+	err error
+}
+
+// A reference on the current path; slices are identified by both their data pointer and length.
+type cycleKey struct {
+	pointer uintptr
+	length int
+}
+
+// A field of a struct encoded as a json object member.
+type structField struct {
+	name string
+	index []int
+	omitEmpty bool
+	quoted bool
+}
+
+// Struct fields sorted by their index in the struct.
+type structFieldsByIndex []structField
+
+// A map entry encoded as a json object member.
+type mapEntry struct {
+	key string
+	value reflect.Value
+}
+
+// Map entries sorted by key as with encoding/json.
+type mapEntriesByKey []mapEntry
+
+// Append the json encoding of the value applying the limits; the first failure, if any, is returned.
+func appendLimitedJsonValue(dst []byte, value interface{}, limits valueLimits) ([]byte, error) {
+	var w eventWriter
+	w.init(eventFormatJson, nil, dst)
+	var err error = writeRedactedValue(&w, value, limits, nil, nil)
+	return w.b, err
+}
+
+// Write the value applying the limits, redacting nested keys matching the redactor, if any, and encoding nested values
+// with the encoders, if any; the value itself is already encoded. The first failure, if any, is returned.
+func writeRedactedValue(w *eventWriter, value interface{}, limits valueLimits, redactor *Redactor, encoders *encoderRegistry) error {
+	switch v := value.(type) {
+	case string:
+		writeLimitedString(w, v, limits.maxStringLength)
+		return nil
+	case json.RawMessage:
+		if (redactor == nil && limits == valueLimits{}) || !isValidJson(v) {
+			return w.writeJson(v)
+		}
+		// Decoded such that the limits and redactor apply to the value
+		value = decodeJsonValue(v)
+	}
+	if ok, err := writeScalarValue(w, value); ok {
+		return err
+	}
+	var encoder limitedEncoder = limitedEncoder{w: w, limits: limits, redactor: redactor, encoders: encoders}
+	encoder.writeEncodedValue(reflect.ValueOf(value), 0)
+	return encoder.err
+}
+
+// Return the string truncated to the maximum length and suffixed by a truncation marker; zero is unlimited.
+func truncateString(s string, maxLength int) string {
+	if maxLength <= 0 || len(s) <= maxLength {
+		return s
+	}
+	var end int = maxLength
+	for end > 0 && !utf8.RuneStart(s[end]) {
+		end--
+	}
+	return s[:end] + truncatedMarker(len(s) - end, "bytes")
+}
+
+// A marker describing the amount of content removed (e.g. "...(truncated 12345 bytes)").
+func truncatedMarker(n int, unit string) string {
+	return "...(truncated " + strconv.Itoa(n) + " " + unit + ")"
+}
+
+// Whether the failure is a reference cycle detected by encoding/json.
+func isCycleError(err error) bool {
+	unsupportedValueError, ok := err.(*json.UnsupportedValueError)
+	return ok && strings.HasPrefix(unsupportedValueError.Str, "encountered a cycle")
+}
+
+// Record the first failure.
+func (le *limitedEncoder) recordError(err error) {
+	if le.err == nil {
+		le.err = err
+	}
+}
+
+// Write a placeholder describing the failure and record it.
+func (le *limitedEncoder) fail(err error) {
+	le.recordError(err)
+	le.w.writeString(placeholder(err))
+}
+
+// Write the value replacing it with the value returned by the encoder registered for its type, if any.
+func (le *limitedEncoder) writeValue(v reflect.Value, depth int) {
+	if le.encoders != nil && v.IsValid() && v.Kind() != reflect.Interface && v.CanInterface() {
+		if encoder := le.encoders.lookup(v.Type()); encoder != nil {
+			value, err := callEncoder(encoder, v.Interface())
+			if err != nil {
+				le.fail(err)
+				return
+			}
+			le.writeEncodedValue(reflect.ValueOf(value), depth)
+			return
+		}
+	}
+	le.writeEncodedValue(v, depth)
+}
+
+func (le *limitedEncoder) writeEncodedValue(v reflect.Value, depth int) {
+	if !v.IsValid() {
+		le.w.writeNull()
+		return
+	}
+	var t reflect.Type = v.Type()
+
+	// Marshalers encode themselves; a nil pointer is encoded as null as with encoding/json
+	if t.Kind() == reflect.Ptr && v.IsNil() {
+		le.w.writeNull()
+		return
+	}
+	if t == lazyValueType && v.CanInterface() {
+		// Evaluated here rather than by its marshaler such that the limits and redactor apply to the value
+		value, err := resolveLazy(v.Interface())
+		if err != nil {
+			le.fail(err)
+			return
+		}
+		le.writeValue(reflect.ValueOf(value), depth)
+		return
+	}
+	if t == secretValueType || t.Kind() == reflect.Ptr && t.Elem() == secretValueType {
+		var secret SecretValue
+		if v.CanInterface() {
+			secret, _ = asSecret(v.Interface())
+		}
+		le.w.writeString(le.redactor.redactSecret(secret))
+		return
+	}
+	if t.Implements(jsonMarshalerType) || (t.Kind() != reflect.Ptr && reflect.PtrTo(t).Implements(jsonMarshalerType) && v.CanAddr()) {
+		if t.Kind() == reflect.Interface && v.IsNil() {
+			le.w.writeNull()
+			return
+		}
+		if !t.Implements(jsonMarshalerType) {
+			v = v.Addr()
+		}
+		jsonBytes, err := marshalValue(v.Interface())
+		if err != nil {
+			le.recordError(err)
+		}
+		le.w.writeJson(jsonBytes)
+		return
+	}
+	if t.Kind() != reflect.Interface && (t.Implements(textMarshalerType) || reflect.PtrTo(t).Implements(textMarshalerType) && v.CanAddr()) {
+		if !t.Implements(textMarshalerType) {
+			v = v.Addr()
+		}
+		text, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			le.fail(err)
+			return
+		}
+		writeLimitedString(le.w, string(text), le.limits.maxStringLength)
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		le.w.writeBool(v.Bool())
+		return
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		le.w.writeInt(v.Int())
+		return
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		le.w.writeUint(v.Uint())
+		return
+	case reflect.Float32, reflect.Float64:
+		if err := le.w.writeFloat(v.Float(), t.Bits()); err != nil {
+			le.recordError(err)
+		}
+		return
+	case reflect.String:
+		if t == jsonNumberType {
+			le.writeNumber(v.String())
+			return
+		}
+		writeLimitedString(le.w, v.String(), le.limits.maxStringLength)
+		return
+	case reflect.Interface:
+		le.writeValue(v.Elem(), depth)
+		return
+	case reflect.Ptr:
+		if le.enter(cycleKey{pointer: v.Pointer()}) {
+			le.w.writeString("<cycle: " + t.String() + ">")
+			return
+		}
+		le.writeValue(v.Elem(), depth)
+		le.leave()
+		return
+	case reflect.Map:
+		if v.IsNil() {
+			le.w.writeNull()
+			return
+		}
+		if le.isTooDeep(depth) {
+			le.w.writeString(truncatedMarker(v.Len(), "entries"))
+			return
+		}
+		if le.enter(cycleKey{pointer: v.Pointer()}) {
+			le.w.writeString("<cycle: " + t.String() + ">")
+			return
+		}
+		le.writeMap(v, depth + 1)
+		le.leave()
+		return
+	case reflect.Slice:
+		if v.IsNil() {
+			le.w.writeNull()
+			return
+		}
+		if t.Elem().Kind() == reflect.Uint8 && !reflect.PtrTo(t.Elem()).Implements(jsonMarshalerType) && !reflect.PtrTo(t.Elem()).Implements(textMarshalerType) {
+			writeLimitedString(le.w, base64.StdEncoding.EncodeToString(v.Bytes()), le.limits.maxStringLength)
+			return
+		}
+		if le.isTooDeep(depth) {
+			le.w.writeString(truncatedMarker(v.Len(), "elements"))
+			return
+		}
+		if le.enter(cycleKey{pointer: v.Pointer(), length: v.Len()}) {
+			le.w.writeString("<cycle: " + t.String() + ">")
+			return
+		}
+		le.writeArray(v, depth + 1)
+		le.leave()
+		return
+	case reflect.Array:
+		if le.isTooDeep(depth) {
+			le.w.writeString(truncatedMarker(v.Len(), "elements"))
+			return
+		}
+		le.writeArray(v, depth + 1)
+		return
+	case reflect.Struct:
+		if le.isTooDeep(depth) {
+			le.w.writeString(truncatedMarker(t.NumField(), "fields"))
+			return
+		}
+		le.writeStruct(v, depth + 1)
+		return
+	}
+	le.fail(&json.UnsupportedTypeError{Type: t})
+}
+
+// Write the json.Number literal as with encoding/json; an empty number is encoded as 0.
+func (le *limitedEncoder) writeNumber(number string) {
+	if number == "" {
+		le.w.writeNumber("0")
+		return
+	}
+	if number[0] != '-' && (number[0] < '0' || number[0] > '9') || !isValidJson([]byte(number)) {
+		le.fail(fmt.Errorf("json: invalid number literal %q", number))
+		return
+	}
+	le.w.writeNumber(number)
+}
+
+func (le *limitedEncoder) isTooDeep(depth int) bool {
+	return le.limits.maxDepth > 0 && depth >= le.limits.maxDepth
+}
+
+// Add the reference to the current path returning whether it is already on the path (i.e. a cycle).
+func (le *limitedEncoder) enter(key cycleKey) bool {
+	for _, visited := range le.path {
+		if visited == key {
+			return true
+		}
+	}
+	le.path = append(le.path, key)
+	return false
+}
+
+func (le *limitedEncoder) leave() {
+	le.path = le.path[:len(le.path) - 1]
+}
+
+func (le *limitedEncoder) writeArray(v reflect.Value, depth int) {
+	var n int = v.Len()
+	var limit int = n
+	if le.limits.maxElements > 0 && n > le.limits.maxElements {
+		limit = le.limits.maxElements
+	}
+	le.w.beginArray()
+	for i := 0; i < limit; i++ {
+		le.writeValue(v.Index(i), depth)
+	}
+	if limit < n {
+		le.w.writeString(truncatedMarker(n - limit, "elements"))
+	}
+	le.w.endArray()
+}
+
+func (le *limitedEncoder) writeMap(v reflect.Value, depth int) {
+	// Keys are sorted as with encoding/json
+	var entries []mapEntry = make([]mapEntry, 0, v.Len())
+	for _, mapKey := range v.MapKeys() {
+		key, err := resolveMapKey(mapKey)
+		if err != nil {
+			le.fail(err)
+			return
+		}
+		if rule := le.lookupRedaction(key); rule != nil && rule.mode == RedactionModeDrop {
+			continue
+		}
+		entries = append(entries, mapEntry{key: key, value: v.MapIndex(mapKey)})
+	}
+	sort.Sort(mapEntriesByKey(entries))
+	var limit int = len(entries)
+	if le.limits.maxElements > 0 && limit > le.limits.maxElements {
+		limit = le.limits.maxElements
+	}
+	le.w.beginObject()
+	for i := 0; i < limit; i++ {
+		le.w.writeName(entries[i].key)
+		le.writeMemberValue(entries[i].key, entries[i].value, depth)
+	}
+	if limit < len(entries) {
+		le.w.writeName("...")
+		le.w.writeString(truncatedMarker(len(entries) - limit, "entries"))
+	}
+	le.w.endObject()
+}
+
+func (le *limitedEncoder) lookupRedaction(key string) *redactionRule {
+	if le.redactor == nil {
+		return nil
+	}
+	return le.redactor.lookup(key)
+}
+
+// Write the value of the object member redacting it if the key matches the redactor.
+func (le *limitedEncoder) writeMemberValue(key string, v reflect.Value, depth int) {
+	var rule *redactionRule = le.lookupRedaction(key)
+	if rule == nil {
+		le.writeValue(v, depth)
+		return
+	}
+	var value interface{}
+	if v.IsValid() && v.CanInterface() {
+		value = v.Interface()
+	}
+	le.w.writeString(le.redactor.redact(rule.mode, value))
+}
+
+// Return the json object member name of the map key as with encoding/json.
+func resolveMapKey(key reflect.Value) (string, error) {
+	if key.Kind() == reflect.String {
+		return key.String(), nil
+	}
+	if textMarshaler, ok := key.Interface().(encoding.TextMarshaler); ok {
+		if key.Kind() == reflect.Ptr && key.IsNil() {
+			return "", nil
+		}
+		text, err := textMarshaler.MarshalText()
+		return string(text), err
+	}
+	switch key.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(key.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(key.Uint(), 10), nil
+	}
+	return "", &json.UnsupportedTypeError{Type: key.Type()}
+}
+
+func (le *limitedEncoder) writeStruct(v reflect.Value, depth int) {
+	var fields []structField = getStructFields(v.Type())
+	le.w.beginObject()
+	var count int = 0
+	for _, field := range fields {
+		fieldValue, ok := fieldByIndex(v, field.index)
+		if !ok || field.omitEmpty && isEmptyValue(fieldValue) {
+			continue
+		}
+		var rule *redactionRule = le.lookupRedaction(field.name)
+		if rule != nil && rule.mode == RedactionModeDrop {
+			continue
+		}
+		if le.limits.maxElements > 0 && count >= le.limits.maxElements {
+			count++
+			continue
+		}
+		count++
+		le.w.writeName(field.name)
+		if rule != nil {
+			le.writeMemberValue(field.name, fieldValue, depth)
+			continue
+		}
+		if field.quoted && !(fieldValue.Kind() == reflect.Ptr && fieldValue.IsNil()) {
+			// The json encoding of the value is itself encoded as a string
+			var quoted eventWriter
+			quoted.init(eventFormatJson, nil, le.w.scratch())
+			var encoder limitedEncoder = limitedEncoder{w: &quoted, limits: le.limits, redactor: le.redactor, encoders: le.encoders, path: le.path}
+			encoder.writeValue(fieldValue, depth)
+			if encoder.err != nil {
+				le.recordError(encoder.err)
+			}
+			le.w.writeStringBytes(quoted.b)
+			continue
+		}
+		le.writeValue(fieldValue, depth)
+	}
+	if le.limits.maxElements > 0 && count > le.limits.maxElements {
+		le.w.writeName("...")
+		le.w.writeString(truncatedMarker(count - le.limits.maxElements, "fields"))
+	}
+	le.w.endObject()
+}
+
+// Return the field following embedded pointers; a nil embedded pointer omits the field as with encoding/json.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+func derefType(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Ptr {
+		return t.Elem()
+	}
+	return t
+}
+
+func isQuotableKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint,
+			reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr, reflect.Float32,
+			reflect.Float64, reflect.String:
+		return true
+	}
+	return false
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		// Negative zero is not empty
+		return math.Float64bits(v.Float()) == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
+
+// Return the encoded fields of the struct type following the encoding/json rules for tags and embedded structs.
+func getStructFields(t reflect.Type) []structField {
+	if fields, ok := structFieldsCache.load(t); ok {
+		return fields.([]structField)
+	}
+	type candidate struct {
+		structField
+		depth int
+		tagged bool
+	}
+	var candidates []candidate
+	// The embedded types on the path to the current type; only a type embedding itself is skipped so the fields of a
+	// type embedded by siblings are collected for each and conflict as with encoding/json
+	var visited map[reflect.Type]bool = map[reflect.Type]bool{}
+	var collect func(t reflect.Type, index []int, depth int)
+	collect = func(t reflect.Type, index []int, depth int) {
+		if visited[t] {
+			return
+		}
+		visited[t] = true
+		defer delete(visited, t)
+		for i := 0; i < t.NumField(); i++ {
+			var field reflect.StructField = t.Field(i)
+			var fieldType reflect.Type = field.Type
+			if field.Anonymous && fieldType.Kind() == reflect.Ptr {
+				fieldType = fieldType.Elem()
+			}
+			if field.PkgPath != "" && !(field.Anonymous && fieldType.Kind() == reflect.Struct) {
+				continue
+			}
+			var tag string = field.Tag.Get("json")
+			if tag == "-" {
+				continue
+			}
+			name, options := splitTag(tag)
+			var fieldIndex []int = append(append([]int(nil), index...), i)
+			if name == "" && field.Anonymous && fieldType.Kind() == reflect.Struct {
+				collect(fieldType, fieldIndex, depth + 1)
+				continue
+			}
+			if field.PkgPath != "" {
+				continue
+			}
+			var tagged bool = name != ""
+			if !tagged {
+				name = field.Name
+			}
+			candidates = append(candidates, candidate{
+				structField: structField{
+					name: name,
+					index: fieldIndex,
+					omitEmpty: hasTagOption(options, "omitempty"),
+					quoted: hasTagOption(options, "string") && isQuotableKind(derefType(field.Type).Kind()),
+				},
+				depth: depth,
+				tagged: tagged,
+			})
+		}
+	}
+	collect(t, nil, 0)
+
+	// Resolve fields with the same name; the shallowest field dominates followed by a tagged field; otherwise all are
+	// omitted
+	var byName map[string][]candidate = map[string][]candidate{}
+	for _, c := range candidates {
+		byName[c.name] = append(byName[c.name], c)
+	}
+	var fields []structField = make([]structField, 0, len(candidates))
+	for _, c := range candidates {
+		var dominant bool = true
+		for _, other := range byName[c.name] {
+			if reflect.DeepEqual(other.index, c.index) {
+				continue
+			}
+			if other.depth < c.depth || other.depth == c.depth && (other.tagged || !c.tagged) {
+				dominant = false
+				break
+			}
+		}
+		if dominant {
+			fields = append(fields, c.structField)
+		}
+	}
+	sort.Stable(structFieldsByIndex(fields))
+	structFieldsCache.store(t, fields)
+	return fields
+}
+
+// Split the struct tag value into its name and options.
+func splitTag(tag string) (string, string) {
+	if i := strings.IndexByte(tag, ','); i >= 0 {
+		return tag[:i], tag[i + 1:]
+	}
+	return tag, ""
+}
+
+func hasTagOption(options string, option string) bool {
+	for options != "" {
+		var current string
+		current, options = splitTag(options)
+		if current == option {
+			return true
+		}
+	}
+	return false
+}
+
+func (sf structFieldsByIndex) Len() int {
+	return len(sf)
+}
+
+func (sf structFieldsByIndex) Less(i int, j int) bool {
+	return lessIndex(sf[i].index, sf[j].index)
+}
+
+func (sf structFieldsByIndex) Swap(i int, j int) {
+	sf[i], sf[j] = sf[j], sf[i]
+}
+
+func (me mapEntriesByKey) Len() int {
+	return len(me)
+}
+
+func (me mapEntriesByKey) Less(i int, j int) bool {
+	return me[i].key < me[j].key
+}
+
+func (me mapEntriesByKey) Swap(i int, j int) {
+	me[i], me[j] = me[j], me[i]
+}
+
+func lessIndex(a []int, b []int) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return len(a) < len(b)
+}
@@ -0,0 +1,375 @@
+/*
+Copyright 2016 Ville Koskela
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package gosteno
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"math/rand"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"github.com/Sirupsen/logrus"
+)
+
+type testEmbedded struct {
+	Shared string
+	Promoted int `json:"promoted,omitempty"`
+}
+
+type testTagged struct {
+	*testEmbedded
+	Name string `json:"name"`
+	Shared string `json:"Shared"`
+	Omitted string `json:",omitempty"`
+	Ignored string `json:"-"`
+	Dash string `json:"-,"`
+	Count int `json:"count,string"`
+	Label string `json:"label,string"`
+	Pointer *int `json:"pointer,string"`
+	unexported string
+	Time time.Time
+	IP net.IP
+	Raw json.RawMessage
+	Bytes []byte
+	Array [2]interface{}
+	Keys map[int]string
+	Texts map[testTextKey]bool
+	Nil map[string]interface{}
+	Empty []string
+	Any interface{}
+}
+
+type testTextKey struct {
+	value string
+}
+
+func (ttk testTextKey) MarshalText() ([]byte, error) {
+	return []byte("key-" + ttk.value), nil
+}
+
+type testNode struct {
+	Name string
+	Next *testNode
+}
+
+type testDiamondBase struct {
+	Base string
+	Shared int `json:"shared"`
+}
+
+type testDiamondLeft struct {
+	testDiamondBase
+	Left []float64
+	Shared bool `json:"shared"`
+}
+
+type testDiamondRight struct {
+	*testDiamondBase
+	Right map[string]int
+}
+
+type testDiamond struct {
+	testDiamondLeft
+	testDiamondRight
+	Name string `json:"name,omitempty"`
+	Count uint8 `json:",string"`
+	Keys map[int]string
+	Flags [2]bool
+	Node *testNode
+	Any interface{}
+}
+
+func TestLimitedEncoderConsistentWithJson(t *testing.T) {
+	t.Parallel()
+	var count int = 7
+	var values []interface{} = []interface{}{
+		nil,
+		"text <html>  ",
+		42,
+		-1.5,
+		[]int{1, 2, 3},
+		map[string]interface{}{"b": 1, "a": []interface{}{"x", nil, true}},
+		testTagged{
+			testEmbedded: &testEmbedded{Shared: "embedded", Promoted: 3},
+			Name: "name",
+			Shared: "outer",
+			Ignored: "ignored",
+			Dash: "dash",
+			Count: 12,
+			Label: "label",
+			Pointer: &count,
+			unexported: "unexported",
+			Time: time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC),
+			IP: net.IPv4(10, 0, 0, 1),
+			Raw: json.RawMessage(`{"raw":true}`),
+			Bytes: []byte{0xca, 0xfe},
+			Array: [2]interface{}{1, "two"},
+			Keys: map[int]string{2: "two", 10: "ten"},
+			Texts: map[testTextKey]bool{{"b"}: true, {"a"}: false},
+			Empty: []string{},
+			Any: &testEmbedded{Shared: "any"},
+		},
+		testTagged{},
+		&testNode{Name: "a", Next: &testNode{Name: "b"}},
+		[]byte("bytes"),
+		[]interface{}{json.Number("-1.50e+3"), json.Number("")},
+	}
+	for _, value := range values {
+		expected, err := json.Marshal(value)
+		if err != nil {
+			t.Fatalf("Unexpected failure marshaling %v", err)
+		}
+		actual, err := appendLimitedJsonValue(nil, value, valueLimits{})
+		if err != nil || string(expected) != string(actual) {
+			t.Errorf("Inconsistent encoding; expected %s but was %s (%v)", string(expected), string(actual), err)
+		}
+	}
+}
+
+func TestLimitedEncoderConsistentWithJsonGenerated(t *testing.T) {
+	t.Parallel()
+	var r *rand.Rand = rand.New(rand.NewSource(1))
+	for _, valueType := range []reflect.Type{reflect.TypeOf((*testDiamond)(nil)).Elem(), reflect.TypeOf((*testTagged)(nil)).Elem()} {
+		for i := 0; i < 200; i++ {
+			var value reflect.Value = reflect.New(valueType).Elem()
+			helperTestRandomValue(r, value, 0)
+			expected, err := json.Marshal(value.Interface())
+			if err != nil {
+				t.Fatalf("Unexpected failure marshaling %v", err)
+			}
+			actual, err := appendLimitedJsonValue(nil, value.Interface(), valueLimits{})
+			if err != nil || string(expected) != string(actual) {
+				t.Errorf("Inconsistent encoding; expected %s but was %s (%v)", string(expected), string(actual), err)
+			}
+		}
+	}
+}
+
+func TestFormatterCycle(t *testing.T) {
+	t.Parallel()
+	var formatter *Formatter = NewFormatter()
+	var cyclicMap map[string]interface{} = map[string]interface{}{"name": "map"}
+	cyclicMap["self"] = cyclicMap
+	var cyclicNode *testNode = &testNode{Name: "a", Next: &testNode{Name: "b"}}
+	cyclicNode.Next.Next = cyclicNode
+	var cyclicSlice []interface{} = []interface{}{"slice", nil}
+	cyclicSlice[1] = cyclicSlice
+	var sharedNode *testNode = &testNode{Name: "shared"}
+	logger, buffer := HelperTestGetLogger("TestFormatterCycle", logrus.DebugLevel, formatter)
+	logger.InfoBuilder().
+			SetMessage("TestFormatterCycle").
+			AddData("map", cyclicMap).
+			AddData("node", cyclicNode).
+			AddData("slice", cyclicSlice).
+			AddData("shared", []*testNode{sharedNode, sharedNode}).
+			Log()
+	var event map[string]map[string]interface{}
+	helperTestUnmarshalBlocks(t, buffer.Bytes(), &event)
+	var expected map[string]string = map[string]string{
+		"map": `{"name":"map","self":"<cycle: map[string]interface {}>"}`,
+		"node": `{"Name":"a","Next":{"Name":"b","Next":"<cycle: *gosteno.testNode>"}}`,
+		"slice": `["slice","<cycle: []interface {}>"]`,
+		"shared": `[{"Name":"shared","Next":null},{"Name":"shared","Next":null}]`,
+	}
+	for key, value := range expected {
+		if actual := helperTestMarshalUnescaped(event["data"][key]); actual != value {
+			t.Errorf("Incorrect encoding of %s; expected %s but was %s", key, value, actual)
+		}
+	}
+	if v := formatter.ErrorCount(); v != 0 {
+		t.Errorf("Incorrect number of failures %v", v)
+	}
+}
+
+func TestFormatterMaxDepth(t *testing.T) {
+	t.Parallel()
+	var formatter *Formatter = NewFormatter()
+	formatter.SetMaxDepth(2)
+	var data map[string]interface{} = helperTestGetLimitedData(t, formatter, map[string]interface{}{
+		"shallow": "value",
+		"nested": map[string]interface{}{"a": []interface{}{1, []interface{}{2, 3}}, "b": map[string]int{"c": 1}},
+		"node": &testNode{Name: "a", Next: &testNode{Name: "b", Next: &testNode{Name: "c"}}},
+	})
+	helperTestVerifyLimitedValue(t, data, "shallow", `"value"`)
+	helperTestVerifyLimitedValue(t, data, "nested", `{"a":[1,"...(truncated 2 elements)"],"b":{"c":1}}`)
+	helperTestVerifyLimitedValue(t, data, "node", `{"Name":"a","Next":{"Name":"b","Next":"...(truncated 2 fields)"}}`)
+}
+
+func TestFormatterMaxElements(t *testing.T) {
+	t.Parallel()
+	var formatter *Formatter = NewFormatter()
+	formatter.SetMaxElements(2)
+	var data map[string]interface{} = helperTestGetLimitedData(t, formatter, map[string]interface{}{
+		"slice": []int{1, 2, 3, 4, 5},
+		"map": map[string]int{"a": 1, "b": 2, "c": 3},
+		"struct": testEmbedded{Shared: "shared", Promoted: 1},
+		"short": []int{1, 2},
+	})
+	helperTestVerifyLimitedValue(t, data, "slice", `[1,2,"...(truncated 3 elements)"]`)
+	helperTestVerifyLimitedValue(t, data, "map", `{"...":"...(truncated 1 entries)","a":1,"b":2}`)
+	helperTestVerifyLimitedValue(t, data, "struct", `{"Shared":"shared","promoted":1}`)
+	helperTestVerifyLimitedValue(t, data, "short", `[1,2]`)
+}
+
+func TestFormatterMaxStringLength(t *testing.T) {
+	t.Parallel()
+	var formatter *Formatter = NewFormatter()
+	formatter.SetMaxStringLength(5)
+	var data map[string]interface{} = helperTestGetLimitedData(t, formatter, map[string]interface{}{
+		"string": "abcdefgh",
+		"unicode": "abcdéfg",
+		"nested": []string{"short", "longer"},
+		"bytes": []byte("abcdefgh"),
+	})
+	helperTestVerifyLimitedValue(t, data, "message", `"TestF...(truncated 21 bytes)"`)
+	helperTestVerifyLimitedValue(t, data, "string", `"abcde...(truncated 3 bytes)"`)
+	helperTestVerifyLimitedValue(t, data, "unicode", `"abcd...(truncated 4 bytes)"`)
+	helperTestVerifyLimitedValue(t, data, "nested", `["short","longe...(truncated 1 bytes)"]`)
+	helperTestVerifyLimitedValue(t, data, "bytes", `"YWJjZ...(truncated 7 bytes)"`)
+}
+
+func TestFormatterMaxEventSize(t *testing.T) {
+	t.Parallel()
+	var formatter *Formatter = NewFormatter()
+	formatter.SetMaxEventSize(200)
+	logger, buffer := HelperTestGetLogger("TestFormatterMaxEventSize", logrus.DebugLevel, formatter)
+	logger.InfoBuilder().
+			SetMessage("TestFormatterMaxEventSize").
+			AddData("huge", strings.Repeat("x", 100000)).
+			Log()
+	var event map[string]map[string]interface{}
+	helperTestUnmarshalBlocks(t, buffer.Bytes(), &event)
+	if v := event["data"]["huge"]; v != "...(truncated 100002 bytes)" {
+		t.Errorf("Incorrect truncation of huge value %v", v)
+	}
+	if buffer.Len() > 500 {
+		t.Errorf("Event exceeds maximum size %d", buffer.Len())
+	}
+	buffer.Reset()
+	logger.InfoBuilder().SetMessage(strings.Repeat("y", 100000)).Log()
+	helperTestUnmarshalBlocks(t, buffer.Bytes(), &event)
+	if v, _ := event["data"]["message"].(string); !strings.HasPrefix(v, "yyy") || !strings.HasSuffix(v, " bytes)") {
+		t.Errorf("Incorrect truncation of huge message %v", v)
+	}
+	if buffer.Len() > 500 {
+		t.Errorf("Event exceeds maximum size %d", buffer.Len())
+	}
+}
+
+func helperTestGetLimitedData(t *testing.T, formatter *Formatter, data map[string]interface{}) map[string]interface{} {
+	logger, buffer := HelperTestGetLogger("TestFormatterLimits", logrus.DebugLevel, formatter)
+	var builder LogBuilder = logger.InfoBuilder().SetMessage("TestFormatterLimitsMessage")
+	for key, value := range data {
+		builder.AddData(key, value)
+	}
+	builder.Log()
+	var event map[string]map[string]interface{}
+	helperTestUnmarshalBlocks(t, buffer.Bytes(), &event)
+	return event["data"]
+}
+
+func helperTestVerifyLimitedValue(t *testing.T, data map[string]interface{}, key string, expected string) {
+	if actual := helperTestMarshalUnescaped(data[key]); actual != expected {
+		t.Errorf("Incorrect encoding of %s; expected %s but was %s", key, expected, actual)
+	}
+}
+
+// Set the value and its exported fields, elements and entries to random values; some values are left zero as are
+// values of types whose random content would be invalid (e.g. raw json).
+func helperTestRandomValue(r *rand.Rand, v reflect.Value, depth int) {
+	if r.Intn(5) == 0 || depth > 4 || v.Type() == reflect.TypeOf((*json.RawMessage)(nil)).Elem() || v.Type() == reflect.TypeOf((*net.IP)(nil)).Elem() {
+		return
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		v.SetBool(r.Intn(2) == 0)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(r.Int63() >> uint(r.Intn(64)) - r.Int63() >> uint(r.Intn(64)))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v.SetUint((uint64(r.Int63()) << 1 | uint64(r.Intn(2))) >> uint(r.Intn(64)))
+	case reflect.Float32, reflect.Float64:
+		v.SetFloat(r.NormFloat64() * math.Pow(10, float64(r.Intn(60) - 30)))
+	case reflect.String:
+		var alphabet []rune = []rune("aZ09 <>&\"\\\n\t\x00\x7f\u00e9\u2028\u2029\ufffd\U0001f600")
+		var runes []rune = make([]rune, r.Intn(8))
+		for i := range runes {
+			runes[i] = alphabet[r.Intn(len(alphabet))]
+		}
+		v.SetString(string(runes))
+	case reflect.Ptr:
+		v.Set(reflect.New(v.Type().Elem()))
+		helperTestRandomValue(r, v.Elem(), depth + 1)
+	case reflect.Interface:
+		var element reflect.Value = reflect.New([]reflect.Type{
+			reflect.TypeOf((*string)(nil)).Elem(),
+			reflect.TypeOf((*float64)(nil)).Elem(),
+			reflect.TypeOf((*[]interface{})(nil)).Elem(),
+			reflect.TypeOf((*map[string]interface{})(nil)).Elem(),
+			reflect.TypeOf((*testDiamondBase)(nil)).Elem(),
+		}[r.Intn(5)]).Elem()
+		helperTestRandomValue(r, element, depth + 1)
+		v.Set(element)
+	case reflect.Slice:
+		v.Set(reflect.MakeSlice(v.Type(), r.Intn(4), 4))
+		fallthrough
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			helperTestRandomValue(r, v.Index(i), depth + 1)
+		}
+	case reflect.Map:
+		v.Set(reflect.MakeMap(v.Type()))
+		for i := r.Intn(4); i > 0; i-- {
+			var key reflect.Value = reflect.New(v.Type().Key()).Elem()
+			var element reflect.Value = reflect.New(v.Type().Elem()).Elem()
+			helperTestRandomValue(r, key, depth + 1)
+			helperTestRandomValue(r, element, depth + 1)
+			v.SetMapIndex(key, element)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			var field reflect.Value = v.Field(i)
+			if field.CanSet() {
+				helperTestRandomValue(r, field, depth + 1)
+			} else if field.Kind() == reflect.Struct {
+				// Exported fields of unexported embedded structs are settable
+				helperTestRandomValue(r, field, depth + 1)
+			}
+		}
+	}
+}
+
+// Marshal the value without escaping the html characters.
+func helperTestMarshalUnescaped(value interface{}) string {
+	var unescaped map[string]string = map[string]string{`\u003c`: "<", `\u003e`: ">", `\u0026`: "&"}
+	var escaped, _ = json.Marshal(value)
+	var buffer bytes.Buffer
+	for i := 0; i < len(escaped); i++ {
+		if escaped[i] != '\\' {
+			buffer.WriteByte(escaped[i])
+		} else if i + 6 <= len(escaped) && unescaped[string(escaped[i:i + 6])] != "" {
+			buffer.WriteString(unescaped[string(escaped[i:i + 6])])
+			i += 5
+		} else {
+			buffer.Write(escaped[i:i + 2])
+			i++
+		}
+	}
+	return buffer.String()
+}
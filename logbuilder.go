@@ -15,6 +15,10 @@ limitations under the License.
 */
 package gosteno
 
+import (
+	"encoding/json"
+)
+
 // LogBuilder interface for assembling log messages.
 type LogBuilder interface {
 
@@ -35,4 +39,22 @@ type LogBuilder interface {
 
 	// Log message.
 	Log()
+}
+
+// DataLogBuilder is an optional interface log builders may implement to add data other than values; the builders of
+// Logger implement it (e.g. logger.InfoBuilder().(gosteno.DataLogBuilder)).
+type DataLogBuilder interface {
+	LogBuilder
+
+	// Lazy data adder; the function is evaluated only when the event is formatted.
+	AddDataFunc(string, func() interface{}) DataLogBuilder
+
+	// Raw json data adder; the value is validated and spliced into the event verbatim.
+	AddDataRaw(string, json.RawMessage) DataLogBuilder
+
+	// Json data setter; the members of the json object are validated and spliced into data verbatim (see JSONMarker).
+	SetDataJSON([]byte) DataLogBuilder
+
+	// Data object setter; the fields of the struct are added as data or context (see ObjectMarker).
+	SetDataObject(interface{}) DataLogBuilder
 }
\ No newline at end of file
@@ -0,0 +1,94 @@
+/*
+Copyright 2016 Ville Koskela
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package gosteno
+
+import (
+	"strconv"
+	"unicode/utf8"
+	"github.com/Sirupsen/logrus"
+)
+
+var (
+	_ logrus.Formatter = (*LogfmtFormatter)(nil)
+)
+
+// LogfmtFormatter renders Steno events as logfmt (e.g. for Heroku style log drains). The event is the same as rendered
+// by Formatter, whose options apply, with nested objects and arrays flattened into dotted keys (e.g. data.user.id=42
+// and exception.backtrace.0=...).
+type LogfmtFormatter struct {
+	*Formatter
+}
+
+func NewLogfmtFormatter() *LogfmtFormatter {
+	return &LogfmtFormatter{Formatter: NewFormatter()}
+}
+
+func (lf *LogfmtFormatter) Format(e *logrus.Entry) ([]byte, error) {
+	var buffer *[]byte = getBuffer()
+	var w *eventWriter = getEventWriter(eventFormatLogfmt, nil, *buffer)
+	lf.Formatter.writeEvent(w, e)
+	var b []byte = append(putEventWriter(w), newLine...)
+	return completeFormat(e, buffer, b), nil
+}
+
+// Append the key and value separated by an equals sign; the value is not quoted.
+func appendLogfmtPair(dst []byte, key []byte, value string) []byte {
+	if len(dst) > 0 {
+		dst = append(dst, ' ')
+	}
+	dst = append(dst, key...)
+	dst = append(dst, '=')
+	return append(dst, value...)
+}
+
+// Append the key of an empty object or array and its value, {} or [] respectively.
+func appendLogfmtEmpty(dst []byte, key []byte, array bool) []byte {
+	if array {
+		return appendLogfmtPair(dst, key, "[]")
+	}
+	return appendLogfmtPair(dst, key, "{}")
+}
+
+// Append the key replacing characters not permitted in logfmt keys (spaces, equals signs, quotes and control
+// characters) with underscores.
+func appendLogfmtKey(dst []byte, key string) []byte {
+	if key == "" {
+		return append(dst, '_')
+	}
+	for _, r := range key {
+		if r <= ' ' || r == '=' || r == '"' || r == 0x7F {
+			dst = append(dst, '_')
+		} else {
+			var encoded [utf8.UTFMax]byte
+			dst = append(dst, encoded[:utf8.EncodeRune(encoded[:], r)]...)
+		}
+	}
+	return dst
+}
+
+// Append the string quoting it if it is empty or contains spaces, equals signs, quotes, backslashes or characters that
+// are not printable.
+func appendLogfmtString(dst []byte, s string) []byte {
+	if s == "" {
+		return append(dst, `""`...)
+	}
+	for _, r := range s {
+		if r <= ' ' || r == '=' || r == '"' || r == '\\' || !strconv.IsPrint(r) {
+			return strconv.AppendQuote(dst, s)
+		}
+	}
+	return append(dst, s...)
+}
@@ -0,0 +1,127 @@
+/*
+Copyright 2016 Ville Koskela
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package gosteno
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+	"github.com/Sirupsen/logrus"
+)
+
+const (
+	logfmtFormatterTestDataPath = "./testdata/logfmtformatter_test/"
+)
+
+func TestLogfmtFormatterMessage(t *testing.T) {
+	t.Parallel()
+	logger, buffer := helperTestGetLogfmtLogger("TestLogfmtFormatterMessage")
+	logger.InfoBuilder().SetMessage("TestLogfmtFormatterMessage").Log()
+	helperTestVerifyLogfmt(t, buffer, "TestLogfmtFormatterMessage")
+}
+
+func TestLogfmtFormatterNestedData(t *testing.T) {
+	t.Parallel()
+	logger, buffer := helperTestGetLogfmtLogger("TestLogfmtFormatterNestedData")
+	logger.DebugBuilder().
+			SetEvent("my_event").
+			SetMessage("TestLogfmtFormatterNestedData with \"quotes\"").
+			AddData("widget", map[string]interface{}{
+				"name": "TestLogfmtFormatterNestedData",
+				"parts": []interface{}{"a=b", "", 1.5, true, nil, []int{}},
+				"empty": map[string]interface{}{},
+				"key with space": "line\nbreak",
+			}).
+			AddContext("requestId", "3186ea94").
+			Log()
+	helperTestVerifyLogfmt(t, buffer, "TestLogfmtFormatterNestedData")
+}
+
+func TestLogfmtFormatterWithError(t *testing.T) {
+	t.Parallel()
+	var formatter *LogfmtFormatter = helperTestGetExactLogfmtFormatter()
+	formatter.SetInjectBacktrace(logrus.ErrorLevel, false)
+	var err error = &testWrappedError{testDomainError{"request failed: timeout"}, errors.New("timeout")}
+	var entry *logrus.Entry = &logrus.Entry{
+		Time: time.Date(2016, 1, 2, 3, 4, 5, 60000000, time.UTC),
+		Level: logrus.ErrorLevel,
+		Message: "TestLogfmtFormatterWithError",
+		Data: logrus.Fields{logrus.ErrorKey: err},
+	}
+	result, formatErr := formatter.Format(entry)
+	if formatErr != nil {
+		t.Errorf("Unexpected failure formatting event %v", formatErr)
+	}
+	helperTestVerifyLogfmt(t, bytes.NewBuffer(result), "TestLogfmtFormatterWithError")
+}
+
+func TestLogfmtFormatterOptions(t *testing.T) {
+	t.Parallel()
+	var formatter *LogfmtFormatter = NewLogfmtFormatter()
+	formatter.SetIdGenerator(NewSequenceIdGenerator())
+	formatter.SetInjectContextLogger(true)
+	logger, buffer := HelperTestGetLogger("TestLogfmtFormatterOptions", logrus.DebugLevel, nil)
+	logger.logger.Formatter = formatter
+	logger.Info("TestLogfmtFormatterOptions")
+	var line string = buffer.String()
+	if !strings.HasPrefix(line, "time=") || !strings.HasSuffix(line, " version=0\n") ||
+			!strings.Contains(line, " name=log level=info data.args.0=TestLogfmtFormatterOptions context.host=") ||
+			!strings.Contains(line, " context.logger=TestLogfmtFormatterOptions id=") {
+		t.Errorf("Incorrect logfmt event %s", line)
+	}
+}
+
+func TestAppendLogfmtString(t *testing.T) {
+	var cases map[string]string = map[string]string{
+		"plain": `plain`,
+		"": `""`,
+		"with space": `"with space"`,
+		"a=b": `"a=b"`,
+		`back\slash`: `"back\\slash"`,
+		"tab\there": `"tab\there"`,
+		"café": "café",
+	}
+	for value, expected := range cases {
+		if actual := string(appendLogfmtString(nil, value)); actual != expected {
+			t.Errorf("Incorrect logfmt string for %q expected %s but was %s", value, expected, actual)
+		}
+	}
+}
+
+func helperTestGetExactLogfmtFormatter() *LogfmtFormatter {
+	return &LogfmtFormatter{Formatter: helperTestGetExactFormatter()}
+}
+
+func helperTestGetLogfmtLogger(n string) (*Logger, *bytes.Buffer) {
+	logger, buffer := HelperTestGetLogger(n, logrus.DebugLevel, nil)
+	logger.logger.Formatter = helperTestGetExactLogfmtFormatter()
+	return logger.WithClock(NewFixedClock(time.Date(2016, 1, 2, 3, 4, 5, 60000000, time.UTC))), buffer
+}
+
+func helperTestVerifyLogfmt(t *testing.T, actualBuffer *bytes.Buffer, name string) {
+	var expectedBuffer []byte
+	var err error
+	if expectedBuffer, err = ioutil.ReadFile(logfmtFormatterTestDataPath + name + ".expected.txt"); err != nil {
+		t.Errorf("Failed to read expected file for %s", name)
+		return
+	}
+	if !bytes.Equal(expectedBuffer, actualBuffer.Bytes()) {
+		t.Errorf("Actual log message does not match expected; expected is\n%s\nbut actual was\n%s", string(expectedBuffer), actualBuffer.String())
+	}
+}
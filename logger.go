@@ -30,6 +30,8 @@ var (
 type Logger struct {
 	name string
 	logger *logrus.Logger
+	threadId string
+	clock Clock
 }
 
 func NewLogger(n string, l *logrus.Logger) *Logger {
@@ -39,12 +41,22 @@ func NewLogger(n string, l *logrus.Logger) *Logger {
 	return &Logger{name: n, logger: l}
 }
 
+// WithThreadId returns a copy of the Logger reporting the logical thread identifier (e.g. a worker id) as the thread.
+func (l *Logger) WithThreadId(threadId string) *Logger {
+	return &Logger{name: l.name, logger: l.logger, threadId: threadId, clock: l.clock}
+}
+
+// WithClock returns a copy of the Logger taking the time of events from the clock (e.g. a FixedClock in tests).
+func (l *Logger) WithClock(clock Clock) *Logger {
+	return &Logger{name: l.name, logger: l.logger, threadId: l.threadId, clock: clock}
+}
+
 // ** Log Builder **
 
 // Debug with LogBuilder. Recommended.
 func (l *Logger) DebugBuilder() LogBuilder {
 	if l.logger.Level >= logrus.DebugLevel {
-		return createLogBuilder(l.logger, logrus.DebugLevel, l.name)
+		return createLogBuilder(l, logrus.DebugLevel)
 	} else {
 		return noopLogBuilder
 	}
@@ -53,7 +65,7 @@ func (l *Logger) DebugBuilder() LogBuilder {
 // Info with LogBuilder. Recommended.
 func (l *Logger) InfoBuilder() LogBuilder {
 	if l.logger.Level >= logrus.InfoLevel {
-		return createLogBuilder(l.logger, logrus.InfoLevel, l.name)
+		return createLogBuilder(l, logrus.InfoLevel)
 	} else {
 		return noopLogBuilder
 	}
@@ -62,7 +74,7 @@ func (l *Logger) InfoBuilder() LogBuilder {
 // Warn with LogBuilder. Recommended.
 func (l *Logger) WarnBuilder() LogBuilder {
 	if l.logger.Level >= logrus.WarnLevel {
-		return createLogBuilder(l.logger, logrus.WarnLevel, l.name)
+		return createLogBuilder(l, logrus.WarnLevel)
 	} else {
 		return noopLogBuilder
 	}
@@ -76,7 +88,7 @@ func (l *Logger) WarningBuilder() LogBuilder {
 // Error with LogBuilder. Recommended.
 func (l *Logger) ErrorBuilder() LogBuilder {
 	if l.logger.Level >= logrus.ErrorLevel {
-		return createLogBuilder(l.logger, logrus.ErrorLevel, l.name)
+		return createLogBuilder(l, logrus.ErrorLevel)
 	} else {
 		return noopLogBuilder
 	}
@@ -85,7 +97,7 @@ func (l *Logger) ErrorBuilder() LogBuilder {
 // Fatal with LogBuilder. Recommended. This implementation like the standard library causes the program to exit.
 func (l *Logger) FatalBuilder() LogBuilder {
 	if l.logger.Level >= logrus.FatalLevel {
-		return createLogBuilder(l.logger, logrus.FatalLevel, l.name)
+		return createLogBuilder(l, logrus.FatalLevel)
 	} else {
 		return noopLogBuilder
 	}
@@ -94,50 +106,137 @@ func (l *Logger) FatalBuilder() LogBuilder {
 // Panic with LogBuilder. Recommended. This implementation like the standard library causes the program to panic.
 func (l *Logger) PanicBuilder() LogBuilder {
 	if l.logger.Level >= logrus.PanicLevel {
-		return createLogBuilder(l.logger, logrus.PanicLevel, l.name)
+		return createLogBuilder(l, logrus.PanicLevel)
 	} else {
 		return noopLogBuilder
 	}
 }
 
+// ** Array Marker **
+
+// Debug with parallel arrays of data and context keys and values and an optional error as with the array marker of
+// LogbackSteno.
+func (l *Logger) DebugArray(
+		event string,
+		message string,
+		dataKeys []string,
+		dataValues []interface{},
+		contextKeys []string,
+		contextValues []interface{},
+		err error) {
+	if l.logger.Level >= logrus.DebugLevel {
+		l.logArray(logrus.DebugLevel, event, message, dataKeys, dataValues, contextKeys, contextValues, err)
+	}
+}
+
+// Info with parallel arrays of data and context keys and values and an optional error as with the array marker of
+// LogbackSteno.
+func (l *Logger) InfoArray(
+		event string,
+		message string,
+		dataKeys []string,
+		dataValues []interface{},
+		contextKeys []string,
+		contextValues []interface{},
+		err error) {
+	if l.logger.Level >= logrus.InfoLevel {
+		l.logArray(logrus.InfoLevel, event, message, dataKeys, dataValues, contextKeys, contextValues, err)
+	}
+}
+
+// Warn with parallel arrays of data and context keys and values and an optional error as with the array marker of
+// LogbackSteno.
+func (l *Logger) WarnArray(
+		event string,
+		message string,
+		dataKeys []string,
+		dataValues []interface{},
+		contextKeys []string,
+		contextValues []interface{},
+		err error) {
+	if l.logger.Level >= logrus.WarnLevel {
+		l.logArray(logrus.WarnLevel, event, message, dataKeys, dataValues, contextKeys, contextValues, err)
+	}
+}
+
+// Warning with parallel arrays of data and context keys and values and an optional error as with the array marker of
+// LogbackSteno.
+func (l *Logger) WarningArray(
+		event string,
+		message string,
+		dataKeys []string,
+		dataValues []interface{},
+		contextKeys []string,
+		contextValues []interface{},
+		err error) {
+	l.WarnArray(event, message, dataKeys, dataValues, contextKeys, contextValues, err)
+}
+
+// Error with parallel arrays of data and context keys and values and an optional error as with the array marker of
+// LogbackSteno.
+func (l *Logger) ErrorArray(
+		event string,
+		message string,
+		dataKeys []string,
+		dataValues []interface{},
+		contextKeys []string,
+		contextValues []interface{},
+		err error) {
+	if l.logger.Level >= logrus.ErrorLevel {
+		l.logArray(logrus.ErrorLevel, event, message, dataKeys, dataValues, contextKeys, contextValues, err)
+	}
+}
+
+// Fatal with parallel arrays of data and context keys and values and an optional error as with the array marker of
+// LogbackSteno. This implementation like the standard library causes the program to exit.
+func (l *Logger) FatalArray(
+		event string,
+		message string,
+		dataKeys []string,
+		dataValues []interface{},
+		contextKeys []string,
+		contextValues []interface{},
+		err error) {
+	if l.logger.Level >= logrus.FatalLevel {
+		l.logArray(logrus.FatalLevel, event, message, dataKeys, dataValues, contextKeys, contextValues, err)
+	}
+}
+
+// Panic with parallel arrays of data and context keys and values and an optional error as with the array marker of
+// LogbackSteno. This implementation like the standard library causes the program to panic.
+func (l *Logger) PanicArray(
+		event string,
+		message string,
+		dataKeys []string,
+		dataValues []interface{},
+		contextKeys []string,
+		contextValues []interface{},
+		err error) {
+	if l.logger.Level >= logrus.PanicLevel {
+		l.logArray(logrus.PanicLevel, event, message, dataKeys, dataValues, contextKeys, contextValues, err)
+	}
+}
+
 // ** Go Log Compatibility **
 
 // Print from standard Go log library. Provided for compatibility.
 func (l *Logger) Print(args ...interface{}) {
 	if l.logger.Level >= logrus.InfoLevel {
-		MarkerMaps.Encode(
-			l.logger,
-			"",		// event name
-			l.name,	// logger name
-			map[string]interface{}{
-				"args": args,
-			},
-			map[string]interface{}{},
-			nil,
-		).Info()
+		l.encodeArgs(args).Info()
 	}
 }
 
 // Printf from standard Go log library. Provided for compatibility.
 func (l *Logger) Printf(format string, args ...interface{}) {
 	if l.logger.Level >= logrus.InfoLevel {
-		l.logger.Infof(format, args...)
+		l.newEntry().Infof(format, args...)
 	}
 }
 
 // Println from standard Go log library. Provided for compatibility.
 func (l *Logger) Println(args ...interface{}) {
 	if l.logger.Level >= logrus.InfoLevel {
-		MarkerMaps.Encode(
-			l.logger,
-			"",		// event name
-			l.name,	// logger name
-			map[string]interface{}{
-				"args": args,
-			},
-			map[string]interface{}{},
-			nil,
-		).Info()
+		l.encodeArgs(args).Info()
 	}
 }
 
@@ -145,16 +244,7 @@ func (l *Logger) Println(args ...interface{}) {
 // Provided for compatibility.
 func (l *Logger) Panic(args ...interface{}) {
 	if l.logger.Level >= logrus.PanicLevel {
-		MarkerMaps.Encode(
-			l.logger,
-			"",		// event name
-			l.name,	// logger name
-			map[string]interface{}{
-				"args": args,
-			},
-			map[string]interface{}{},
-			nil,
-		).Panic()
+		l.encodeArgs(args).Panic()
 	}
 }
 
@@ -162,7 +252,7 @@ func (l *Logger) Panic(args ...interface{}) {
 // Provided for compatibility.
 func (l *Logger) Panicf(format string, args ...interface{}) {
 	if l.logger.Level >= logrus.PanicLevel {
-		l.logger.Panicf(format, args...)
+		l.newEntry().Panicf(format, args...)
 	}
 }
 
@@ -170,16 +260,7 @@ func (l *Logger) Panicf(format string, args ...interface{}) {
 // Provided for compatibility.
 func (l *Logger) Panicln(args ...interface{}) {
 	if l.logger.Level >= logrus.PanicLevel {
-		MarkerMaps.Encode(
-			l.logger,
-			"",		// event name
-			l.name,	// logger name
-			map[string]interface{}{
-				"args": args,
-			},
-			map[string]interface{}{},
-			nil,
-		).Panic()
+		l.encodeArgs(args).Panic()
 	}
 }
 
@@ -187,16 +268,7 @@ func (l *Logger) Panicln(args ...interface{}) {
 // Provided for compatibility.
 func (l *Logger) Fatal(args ...interface{}) {
 	if l.logger.Level >= logrus.FatalLevel {
-		MarkerMaps.Encode(
-			l.logger,
-			"",		// event name
-			l.name,	// logger name
-			map[string]interface{}{
-				"args": args,
-			},
-			map[string]interface{}{},
-			nil,
-		).Fatal()
+		l.encodeArgs(args).Fatal()
 	}
 }
 
@@ -204,7 +276,7 @@ func (l *Logger) Fatal(args ...interface{}) {
 // Provided for compatibility.
 func (l *Logger) Fatalf(format string, args ...interface{}) {
 	if l.logger.Level >= logrus.FatalLevel {
-		l.logger.Fatalf(format, args...)
+		l.newEntry().Fatalf(format, args...)
 	}
 }
 
@@ -212,16 +284,7 @@ func (l *Logger) Fatalf(format string, args ...interface{}) {
 // Provided for compatibility.
 func (l *Logger) Fatalln(args ...interface{}) {
 	if l.logger.Level >= logrus.FatalLevel {
-		MarkerMaps.Encode(
-			l.logger,
-			"",		// event name
-			l.name,	// logger name
-			map[string]interface{}{
-				"args": args,
-			},
-			map[string]interface{}{},
-			nil,
-		).Fatal()
+		l.encodeArgs(args).Fatal()
 	}
 }
 
@@ -287,117 +350,63 @@ func Output(calldepth int, s string) error {
 // Debug from github.com/Sirupsen/logrus library. Provided for compatibility.
 func (l *Logger) Debug(args ...interface{}) {
 	if l.logger.Level >= logrus.DebugLevel {
-		MarkerMaps.Encode(
-			l.logger,
-			"",		// event name
-			l.name,	// logger name
-			map[string]interface{}{
-				"args": args,
-			},
-			map[string]interface{}{},
-			nil,
-		).Debug()
+		l.encodeArgs(args).Debug()
 	}
 }
 
 // Debugf from github.com/Sirupsen/logrus library. Provided for compatibility.
 func (l *Logger) Debugf(format string, args ...interface{}) {
 	if l.logger.Level >= logrus.DebugLevel {
-		l.logger.Debugf(format, args...)
+		l.newEntry().Debugf(format, args...)
 	}
 }
 
 // Debugln from github.com/Sirupsen/logrus library. Provided for compatibility.
 func (l *Logger) Debugln(args ...interface{}) {
 	if l.logger.Level >= logrus.DebugLevel {
-		MarkerMaps.Encode(
-			l.logger,
-			"",		// event name
-			l.name,	// logger name
-			map[string]interface{}{
-				"args": args,
-			},
-			map[string]interface{}{},
-			nil,
-		).Debug()
+		l.encodeArgs(args).Debug()
 	}
 }
 
 // Info from github.com/Sirupsen/logrus library. Provided for compatibility.
 func (l *Logger) Info(args ...interface{}) {
 	if l.logger.Level >= logrus.InfoLevel {
-		MarkerMaps.Encode(
-			l.logger,
-			"",		// event name
-			l.name,	// logger name
-			map[string]interface{}{
-				"args": args,
-			},
-			map[string]interface{}{},
-			nil,
-		).Info()
+		l.encodeArgs(args).Info()
 	}
 }
 
 // Infof from github.com/Sirupsen/logrus library. Provided for compatibility.
 func (l *Logger) Infof(format string, args ...interface{}) {
 	if l.logger.Level >= logrus.InfoLevel {
-		l.logger.Infof(format, args...)
+		l.newEntry().Infof(format, args...)
 	}
 }
 
 // Infoln from github.com/Sirupsen/logrus library. Provided for compatibility.
 func (l *Logger) Infoln(args ...interface{}) {
 	if l.logger.Level >= logrus.InfoLevel {
-		MarkerMaps.Encode(
-			l.logger,
-			"",		// event name
-			l.name,	// logger name
-			map[string]interface{}{
-				"args": args,
-			},
-			map[string]interface{}{},
-			nil,
-		).Info()
+		l.encodeArgs(args).Info()
 	}
 }
 
 // Warn from github.com/Sirupsen/logrus library. Provided for compatibility.
 func (l *Logger) Warn(args ...interface{}) {
 	if l.logger.Level >= logrus.WarnLevel {
-		MarkerMaps.Encode(
-			l.logger,
-			"",		// event name
-			l.name,	// logger name
-			map[string]interface{}{
-				"args": args,
-			},
-			map[string]interface{}{},
-			nil,
-		).Warn()
+		l.encodeArgs(args).Warn()
 	}
 }
 
 // Warnf from github.com/Sirupsen/logrus library. Provided for compatibility.
 func (l *Logger) Warnf(format string, args ...interface{}) {
 	if l.logger.Level >= logrus.WarnLevel {
-		l.logger.Warnf(format, args...)
+		l.newEntry().Warnf(format, args...)
 	}
 }
 
 // Warnln from github.com/Sirupsen/logrus library. Provided for compatibility.
 func (l *Logger) Warnln(args ...interface{}) {
 	if l.logger.Level >= logrus.WarnLevel {
-		MarkerMaps.Encode(
-			l.logger,
-			"",		// event name
-			l.name,	// logger name
-			map[string]interface{}{
-				"args": args,
-			},
-			map[string]interface{}{},
-			nil,
-		).Warn()
+		l.encodeArgs(args).Warn()
 	}
 }
 
@@ -419,60 +428,99 @@ func (l *Logger) Warningln(args ...interface{}) {
 // Error from github.com/Sirupsen/logrus library. Provided for compatibility.
 func (l *Logger) Error(args ...interface{}) {
 	if l.logger.Level >= logrus.ErrorLevel {
-		MarkerMaps.Encode(
-			l.logger,
-			"",		// event name
-			l.name,	// logger name
-			map[string]interface{}{
-				"args": args,
-			},
-			map[string]interface{}{},
-			nil,
-		).Error()
+		l.encodeArgs(args).Error()
 	}
 }
 
 // Errorf from github.com/Sirupsen/logrus library. Provided for compatibility.
 func (l *Logger) Errorf(format string, args ...interface{}) {
 	if l.logger.Level >= logrus.ErrorLevel {
-		l.logger.Errorf(format, args...)
+		l.newEntry().Errorf(format, args...)
 	}
 }
 
 // Errorln from github.com/Sirupsen/logrus library. Provided for compatibility.
 func (l *Logger) Errorln(args ...interface{}) {
 	if l.logger.Level >= logrus.ErrorLevel {
-		MarkerMaps.Encode(
-			l.logger,
-			"",		// event name
-			l.name,	// logger name
-			map[string]interface{}{
-				"args": args,
-			},
-			map[string]interface{}{},
-			nil,
-		).Error()
+		l.encodeArgs(args).Error()
 	}
 }
 
 // WithField from github.com/Sirupsen/logrus library. Provided for compatibility.
 func (l *Logger) WithField(key string, value interface{}) *logrus.Entry {
-	return logrus.NewEntry(l.logger).WithField(key, value)
+	return l.newEntry().WithField(key, value)
 }
 
 // WithFields from github.com/Sirupsen/logrus library. Provided for compatibility.
 func (l *Logger) WithFields(fields logrus.Fields) *logrus.Entry {
-	return logrus.NewEntry(l.logger).WithFields(fields)
+	return l.newEntry().WithFields(fields)
 }
 
 // WithError from github.com/Sirupsen/logrus library. Provided for compatibility.
 func (l *Logger) WithError(err error) *logrus.Entry {
-	return logrus.NewEntry(l.logger).WithError(err)
+	var entry *logrus.Entry = l.newEntry().WithError(err)
+	if err != nil {
+		entry.Data[StackKey] = captureStack(1)
+	}
+	return entry
 }
 
 // ** Private implementation **
 
-func createLogBuilder(l *logrus.Logger, v logrus.Level, n string) LogBuilder {
-	var lb *DefaultLogBuilder = NewDefaultLogBuilder(l, v, n)
+func createLogBuilder(l *Logger, v logrus.Level) LogBuilder {
+	var lb *DefaultLogBuilder = NewDefaultLogBuilder(l.logger, v, l.name)
+	lb.threadId = l.threadId
+	lb.clock = l.clock
 	return lb
 }
+
+func (l *Logger) logArray(
+		v logrus.Level,
+		event string,
+		message string,
+		dataKeys []string,
+		dataValues []interface{},
+		contextKeys []string,
+		contextValues []interface{},
+		err error) {
+	var entry *logrus.Entry = MarkerArray.Encode(
+		l.logger,
+		event,
+		l.name,
+		dataKeys,
+		dataValues,
+		contextKeys,
+		contextValues,
+		err,
+	)
+	output(l.annotate(entry), message, l.logger, v)
+}
+
+func (l *Logger) newEntry() *logrus.Entry {
+	return l.annotate(logrus.NewEntry(l.logger))
+}
+
+func (l *Logger) encodeArgs(args []interface{}) *logrus.Entry {
+	var entry *logrus.Entry = MarkerMaps.Encode(
+		l.logger,
+		"",		// event name
+		l.name,	// logger name
+		map[string]interface{}{
+			"args": args,
+		},
+		map[string]interface{}{},
+		nil,
+	)
+	return l.annotate(entry)
+}
+
+// Add the logical thread identifier and the time from the clock, if any, to the entry.
+func (l *Logger) annotate(entry *logrus.Entry) *logrus.Entry {
+	if l.threadId != "" {
+		entry.Data[ThreadKey] = l.threadId
+	}
+	if l.clock != nil {
+		entry.Data[TimeKey] = l.clock.Now()
+	}
+	return entry
+}
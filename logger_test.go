@@ -17,6 +17,7 @@ package gosteno
 
 import (
 	"testing"
+	"time"
 	"github.com/Sirupsen/logrus"
 	"errors"
 )
@@ -104,6 +105,125 @@ func TestLoggerErrorBuilderLevelSuppressed(t *testing.T) {
 	HelperTestVerifyEmpty(t, buffer)
 }
 
+func TestLoggerDebugArray(t *testing.T) {
+	t.Parallel()
+	logger, buffer := HelperTestGetLogger("TestLoggerDebugArray", logrus.DebugLevel, loggerTestFormatter)
+	logger.DebugArray(
+		"my_event",
+		"TestLoggerDebugArray",
+		[]string{"foo", "one", "none"},
+		[]interface{}{"bar", 1},
+		[]string{"threadId"},
+		[]interface{}{"main"},
+		nil)
+	HelperTestVerify(t, buffer, loggerTestDataPath + "TestLoggerDebugArray.expected.json")
+}
+
+func TestLoggerDebugArrayLevelSuppressed(t *testing.T) {
+	t.Parallel()
+	logger, buffer := HelperTestGetLogger("TestLoggerDebugArrayLevelSuppressed", logrus.InfoLevel, loggerTestFormatter)
+	logger.DebugArray("my_event", "TestLoggerDebugArrayLevelSuppressed", nil, nil, nil, nil, nil)
+	HelperTestVerifyEmpty(t, buffer)
+}
+
+func TestLoggerInfoArray(t *testing.T) {
+	t.Parallel()
+	logger, buffer := HelperTestGetLogger("TestLoggerInfoArray", logrus.InfoLevel, loggerTestFormatter)
+	logger.InfoArray(
+		"my_event",
+		"TestLoggerInfoArray",
+		[]string{"foo", "one", "none"},
+		[]interface{}{"bar", 1},
+		[]string{"threadId"},
+		[]interface{}{"main"},
+		nil)
+	HelperTestVerify(t, buffer, loggerTestDataPath + "TestLoggerInfoArray.expected.json")
+}
+
+func TestLoggerInfoArrayWithError(t *testing.T) {
+	t.Parallel()
+	logger, buffer := HelperTestGetLogger("TestLoggerInfoArrayWithError", logrus.InfoLevel, loggerTestFormatter)
+	logger.InfoArray(
+		"my_event",
+		"TestLoggerInfoArrayWithError",
+		[]string{"foo"},
+		[]interface{}{"bar"},
+		nil,
+		nil,
+		errors.New("This is an error"))
+	HelperTestVerify(t, buffer, loggerTestDataPath + "TestLoggerInfoArrayWithError.expected.json")
+}
+
+func TestLoggerInfoArrayLevelSuppressed(t *testing.T) {
+	t.Parallel()
+	logger, buffer := HelperTestGetLogger("TestLoggerInfoArrayLevelSuppressed", logrus.WarnLevel, loggerTestFormatter)
+	logger.InfoArray("my_event", "TestLoggerInfoArrayLevelSuppressed", nil, nil, nil, nil, nil)
+	HelperTestVerifyEmpty(t, buffer)
+}
+
+func TestLoggerWarnArray(t *testing.T) {
+	t.Parallel()
+	logger, buffer := HelperTestGetLogger("TestLoggerWarnArray", logrus.WarnLevel, loggerTestFormatter)
+	logger.WarnArray(
+		"my_event",
+		"TestLoggerWarnArray",
+		[]string{"foo", "one", "none"},
+		[]interface{}{"bar", 1},
+		[]string{"threadId"},
+		[]interface{}{"main"},
+		nil)
+	HelperTestVerify(t, buffer, loggerTestDataPath + "TestLoggerWarnArray.expected.json")
+}
+
+func TestLoggerWarnArrayLevelSuppressed(t *testing.T) {
+	t.Parallel()
+	logger, buffer := HelperTestGetLogger("TestLoggerWarnArrayLevelSuppressed", logrus.ErrorLevel, loggerTestFormatter)
+	logger.WarnArray("my_event", "TestLoggerWarnArrayLevelSuppressed", nil, nil, nil, nil, nil)
+	HelperTestVerifyEmpty(t, buffer)
+}
+
+func TestLoggerWarningArray(t *testing.T) {
+	t.Parallel()
+	logger, buffer := HelperTestGetLogger("TestLoggerWarningArray", logrus.WarnLevel, loggerTestFormatter)
+	logger.WarningArray(
+		"my_event",
+		"TestLoggerWarningArray",
+		[]string{"foo", "one", "none"},
+		[]interface{}{"bar", 1},
+		[]string{"threadId"},
+		[]interface{}{"main"},
+		nil)
+	HelperTestVerify(t, buffer, loggerTestDataPath + "TestLoggerWarningArray.expected.json")
+}
+
+func TestLoggerWarningArrayLevelSuppressed(t *testing.T) {
+	t.Parallel()
+	logger, buffer := HelperTestGetLogger("TestLoggerWarningArrayLevelSuppressed", logrus.ErrorLevel, loggerTestFormatter)
+	logger.WarningArray("my_event", "TestLoggerWarningArrayLevelSuppressed", nil, nil, nil, nil, nil)
+	HelperTestVerifyEmpty(t, buffer)
+}
+
+func TestLoggerErrorArray(t *testing.T) {
+	t.Parallel()
+	logger, buffer := HelperTestGetLogger("TestLoggerErrorArray", logrus.ErrorLevel, loggerTestFormatter)
+	logger.ErrorArray(
+		"my_event",
+		"TestLoggerErrorArray",
+		[]string{"foo", "one", "none"},
+		[]interface{}{"bar", 1},
+		[]string{"threadId"},
+		[]interface{}{"main"},
+		nil)
+	HelperTestVerify(t, buffer, loggerTestDataPath + "TestLoggerErrorArray.expected.json")
+}
+
+func TestLoggerErrorArrayLevelSuppressed(t *testing.T) {
+	t.Parallel()
+	logger, buffer := HelperTestGetLogger("TestLoggerErrorArrayLevelSuppressed", logrus.FatalLevel, loggerTestFormatter)
+	logger.ErrorArray("my_event", "TestLoggerErrorArrayLevelSuppressed", nil, nil, nil, nil, nil)
+	HelperTestVerifyEmpty(t, buffer)
+}
+
 func TestLoggerPrint(t *testing.T) {
 	t.Parallel()
 	logger, buffer := HelperTestGetLogger("TestLoggerPrint", logrus.InfoLevel, loggerTestFormatter)
@@ -376,3 +496,22 @@ func TestLoggerWithError(t *testing.T) {
 	logger.WithError(errors.New("This is an error")).Info("TestLoggerWithError")
 	HelperTestVerify(t, buffer, loggerTestDataPath + "TestLoggerWithError.expected.json")
 }
+
+func TestLoggerEntryInternalKeys(t *testing.T) {
+	t.Parallel()
+	logger, _ := HelperTestGetLogger("TestLoggerEntryInternalKeys", logrus.InfoLevel, loggerTestFormatter)
+	var entry *logrus.Entry = logger.WithField("foo", "bar")
+	if _, ok := entry.Data[ThreadKey]; ok {
+		t.Errorf("Entry has thread without logical thread identifier")
+	}
+	if _, ok := entry.Data[TimeKey]; ok {
+		t.Errorf("Entry has time without clock")
+	}
+	entry = logger.WithThreadId("worker-7").WithClock(NewFixedClock(time.Unix(0, 0))).WithField("foo", "bar")
+	if v := entry.Data[ThreadKey]; v != "worker-7" {
+		t.Errorf("Entry thread is %v, expected worker-7", v)
+	}
+	if _, ok := entry.Data[TimeKey]; !ok {
+		t.Errorf("Entry has no time with clock")
+	}
+}
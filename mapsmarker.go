@@ -43,6 +43,22 @@ func (smm *MapsMarker) Encode(
 		context map[string]interface{},
 		err error) *logrus.Entry {
 
+	var s stack
+	if err != nil {
+		s = captureStack(1)
+	}
+	return smm.encode(logger, event, loggerName, data, context, err, s)
+}
+
+func (smm *MapsMarker) encode(
+		logger *logrus.Logger,
+		event string,
+		loggerName string,
+		data map[string]interface{},
+		context map[string]interface{},
+		err error,
+		s stack) *logrus.Entry {
+
 	var entry *logrus.Entry = logrus.NewEntry(logger).WithFields(logrus.Fields{
 		MarkerKey: smm,
 		EVENT_DATA_EVENT_KEY: event,
@@ -50,6 +66,9 @@ func (smm *MapsMarker) Encode(
 		EVENT_DATA_DATA_KEY: data,
 		EVENT_DATA_CONTEXT_KEY: context,
 		EVENT_DATA_ERROR_KEY: err,})
+	if s != nil {
+		entry.Data[StackKey] = s
+	}
 	return entry
 }
 
@@ -18,9 +18,27 @@ package gosteno
 const (
 	// The field name containing a descriptor of the field format.
 	MarkerKey string = "__gosteno.marker__"
+
+	// The field name containing the call stack captured with the error.
+	StackKey string = "__gosteno.stack__"
+
+	// The field name containing the logical thread identifier.
+	ThreadKey string = "__gosteno.thread__"
+
+	// The field name containing the event time supplied by a Clock.
+	TimeKey string = "__gosteno.time__"
 )
 
 var (
 	// The marker for steno as maps format descriptor.
 	MarkerMaps *MapsMarker = new(MapsMarker)
+
+	// The marker for steno as arrays format descriptor.
+	MarkerArray *ArrayMarker = new(ArrayMarker)
+
+	// The marker for steno as object format descriptor.
+	MarkerObject *ObjectMarker = new(ObjectMarker)
+
+	// The marker for steno as pre-serialized json format descriptor.
+	MarkerJSON *JSONMarker = new(JSONMarker)
 )
@@ -0,0 +1,264 @@
+/*
+Copyright 2016 Ville Koskela
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package gosteno
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"github.com/Sirupsen/logrus"
+)
+
+var (
+	_ logrus.Formatter = (*MsgpackFormatter)(nil)
+	_ binaryCodec = msgpackCodec{}
+)
+
+// MsgpackFormatter renders Steno events as MessagePack (https://msgpack.org). The event is the same document as
+// rendered by Formatter, whose options apply, and is prefixed by its length as a four byte big endian integer. Use
+// NewMsgpackDecoder to convert the events back to Steno json.
+type MsgpackFormatter struct {
+	*Formatter
+}
+
+func NewMsgpackFormatter() *MsgpackFormatter {
+	return &MsgpackFormatter{Formatter: NewFormatter()}
+}
+
+func (mf *MsgpackFormatter) Format(e *logrus.Entry) ([]byte, error) {
+	return formatBinary(mf.Formatter, msgpackCodec{}, e)
+}
+
+type msgpackCodec struct {
+}
+
+func (msgpackCodec) appendNil(dst []byte) []byte {
+	return append(dst, 0xc0)
+}
+
+func (msgpackCodec) appendBool(dst []byte, v bool) []byte {
+	if v {
+		return append(dst, 0xc3)
+	}
+	return append(dst, 0xc2)
+}
+
+func (mc msgpackCodec) appendInt(dst []byte, v int64) []byte {
+	switch {
+	case v >= 0:
+		return mc.appendUint(dst, uint64(v))
+	case v >= -32:
+		return append(dst, byte(v))
+	case v >= math.MinInt8:
+		return append(dst, 0xd0, byte(v))
+	case v >= math.MinInt16:
+		return appendUint16(append(dst, 0xd1), uint16(v))
+	case v >= math.MinInt32:
+		return appendUint32(append(dst, 0xd2), uint32(v))
+	}
+	return appendUint64(append(dst, 0xd3), uint64(v))
+}
+
+func (msgpackCodec) appendUint(dst []byte, v uint64) []byte {
+	switch {
+	case v <= math.MaxInt8:
+		return append(dst, byte(v))
+	case v <= math.MaxUint8:
+		return append(dst, 0xcc, byte(v))
+	case v <= math.MaxUint16:
+		return appendUint16(append(dst, 0xcd), uint16(v))
+	case v <= math.MaxUint32:
+		return appendUint32(append(dst, 0xce), uint32(v))
+	}
+	return appendUint64(append(dst, 0xcf), v)
+}
+
+func (msgpackCodec) appendFloat(dst []byte, v float64) []byte {
+	return appendUint64(append(dst, 0xcb), math.Float64bits(v))
+}
+
+func (msgpackCodec) appendFloat32(dst []byte, v float32) []byte {
+	return appendUint32(append(dst, 0xca), math.Float32bits(v))
+}
+
+func (msgpackCodec) appendStringHeader(dst []byte, n int) []byte {
+	switch {
+	case n < 32:
+		return append(dst, 0xa0 | byte(n))
+	case n <= math.MaxUint8:
+		return append(dst, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		return appendUint16(append(dst, 0xda), uint16(n))
+	}
+	return appendUint32(append(dst, 0xdb), uint32(n))
+}
+
+func (msgpackCodec) appendArrayHeader(dst []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(dst, 0x90 | byte(n))
+	case n <= math.MaxUint16:
+		return appendUint16(append(dst, 0xdc), uint16(n))
+	}
+	return appendUint32(append(dst, 0xdd), uint32(n))
+}
+
+func (msgpackCodec) appendMapHeader(dst []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(dst, 0x80 | byte(n))
+	case n <= math.MaxUint16:
+		return appendUint16(append(dst, 0xde), uint16(n))
+	}
+	return appendUint32(append(dst, 0xdf), uint32(n))
+}
+
+func (mc msgpackCodec) appendJson(dst []byte, src []byte, depth int) ([]byte, []byte, error) {
+	if len(src) == 0 {
+		return dst, src, errTruncated
+	}
+	if depth > maxDecodeDepth {
+		return dst, src, fmt.Errorf("gosteno: msgpack nesting exceeds maximum depth %d", maxDecodeDepth)
+	}
+	var b byte = src[0]
+	src = src[1:]
+	var value []byte
+	var err error
+	switch {
+	case b <= 0x7f:
+		return strconv.AppendUint(dst, uint64(b), 10), src, nil
+	case b >= 0xe0:
+		return strconv.AppendInt(dst, int64(int8(b)), 10), src, nil
+	case b >= 0xa0 && b <= 0xbf:
+		return mc.appendJsonString(dst, src, uint64(b & 0x1f))
+	case b >= 0x90 && b <= 0x9f:
+		return mc.appendJsonArray(dst, src, uint64(b & 0x0f), depth)
+	case b >= 0x80 && b <= 0x8f:
+		return mc.appendJsonMap(dst, src, uint64(b & 0x0f), depth)
+	}
+	switch b {
+	case 0xc0:
+		return append(dst, "null"...), src, nil
+	case 0xc2:
+		return append(dst, "false"...), src, nil
+	case 0xc3:
+		return append(dst, "true"...), src, nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		if value, src, err = splitBytes(src, 1 << (b - 0xcc)); err != nil {
+			return dst, src, err
+		}
+		return strconv.AppendUint(dst, readUint(value), 10), src, nil
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		if value, src, err = splitBytes(src, 1 << (b - 0xd0)); err != nil {
+			return dst, src, err
+		}
+		var shift uint = uint(64 - 8 * len(value))
+		return strconv.AppendInt(dst, int64(readUint(value) << shift) >> shift, 10), src, nil
+	case 0xca:
+		if value, src, err = splitBytes(src, 4); err != nil {
+			return dst, src, err
+		}
+		dst, err = appendDecodedFloat(dst, float64(math.Float32frombits(binary.BigEndian.Uint32(value))), 32)
+		return dst, src, err
+	case 0xcb:
+		if value, src, err = splitBytes(src, 8); err != nil {
+			return dst, src, err
+		}
+		dst, err = appendDecodedFloat(dst, math.Float64frombits(binary.BigEndian.Uint64(value)), 64)
+		return dst, src, err
+	case 0xd9, 0xda, 0xdb, 0xc4, 0xc5, 0xc6, 0xdc, 0xdd, 0xde, 0xdf:
+		var size uint64 = 1
+		switch b {
+		case 0xda, 0xc5, 0xdc, 0xde:
+			size = 2
+		case 0xdb, 0xc6, 0xdd, 0xdf:
+			size = 4
+		}
+		if value, src, err = splitBytes(src, size); err != nil {
+			return dst, src, err
+		}
+		var n uint64 = readUint(value)
+		switch b {
+		case 0xd9, 0xda, 0xdb:
+			return mc.appendJsonString(dst, src, n)
+		case 0xc4, 0xc5, 0xc6:
+			if value, src, err = splitBytes(src, n); err != nil {
+				return dst, src, err
+			}
+			return appendJsonBytes(dst, value), src, nil
+		case 0xdc, 0xdd:
+			return mc.appendJsonArray(dst, src, n, depth)
+		}
+		return mc.appendJsonMap(dst, src, n, depth)
+	}
+	return dst, src, fmt.Errorf("gosteno: unsupported msgpack type 0x%02x", b)
+}
+
+func (msgpackCodec) appendJsonString(dst []byte, src []byte, n uint64) ([]byte, []byte, error) {
+	value, src, err := splitBytes(src, n)
+	if err != nil {
+		return dst, src, err
+	}
+	return appendJsonString(dst, string(value)), src, nil
+}
+
+func (mc msgpackCodec) appendJsonArray(dst []byte, src []byte, n uint64, depth int) ([]byte, []byte, error) {
+	var err error
+	dst = append(dst, '[')
+	for i := uint64(0); i < n; i++ {
+		if i > 0 {
+			dst = append(dst, ',')
+		}
+		if dst, src, err = mc.appendJson(dst, src, depth + 1); err != nil {
+			return dst, src, err
+		}
+	}
+	return append(dst, ']'), src, nil
+}
+
+func (mc msgpackCodec) appendJsonMap(dst []byte, src []byte, n uint64, depth int) ([]byte, []byte, error) {
+	var err error
+	dst = append(dst, '{')
+	for i := uint64(0); i < n; i++ {
+		if i > 0 {
+			dst = append(dst, ',')
+		}
+		if len(src) == 0 {
+			return dst, src, errTruncated
+		}
+		if b := src[0]; !(b >= 0xa0 && b <= 0xbf || b >= 0xd9 && b <= 0xdb) {
+			return dst, src, fmt.Errorf("gosteno: unsupported msgpack map key type 0x%02x", b)
+		}
+		if dst, src, err = mc.appendJson(dst, src, depth + 1); err != nil {
+			return dst, src, err
+		}
+		dst = append(dst, ':')
+		if dst, src, err = mc.appendJson(dst, src, depth + 1); err != nil {
+			return dst, src, err
+		}
+	}
+	return append(dst, '}'), src, nil
+}
+
+// Read a big endian unsigned integer of up to eight bytes.
+func readUint(b []byte) uint64 {
+	var v uint64
+	for _, c := range b {
+		v = v << 8 | uint64(c)
+	}
+	return v
+}
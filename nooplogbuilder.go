@@ -15,8 +15,12 @@ limitations under the License.
 */
 package gosteno
 
+import (
+	"encoding/json"
+)
+
 var (
-	_ LogBuilder = (*NoOpLogBuilder)(nil)
+	_ DataLogBuilder = (*NoOpLogBuilder)(nil)
 )
 
 // NoOpLogBuilder is a LogBuilder implementation that satisfies the LogBuilder contract without empty implementations.
@@ -39,6 +43,22 @@ func (nolb *NoOpLogBuilder) AddData(key string, value interface{}) LogBuilder {
 	return nolb
 }
 
+func (nolb *NoOpLogBuilder) AddDataFunc(key string, f func() interface{}) DataLogBuilder {
+	return nolb
+}
+
+func (nolb *NoOpLogBuilder) AddDataRaw(key string, value json.RawMessage) DataLogBuilder {
+	return nolb
+}
+
+func (nolb *NoOpLogBuilder) SetDataJSON(data []byte) DataLogBuilder {
+	return nolb
+}
+
+func (nolb *NoOpLogBuilder) SetDataObject(object interface{}) DataLogBuilder {
+	return nolb
+}
+
 func (nolb *NoOpLogBuilder) AddContext(key string, value interface{}) LogBuilder {
 	return nolb
 }
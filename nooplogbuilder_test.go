@@ -16,13 +16,14 @@ limitations under the License.
 package gosteno
 
 import (
+	"encoding/json"
 	"errors"
 	"testing"
 )
 
 func TestNoOpLogBuilder(t *testing.T) {
 	t.Parallel()
-	var nolb LogBuilder = new(NoOpLogBuilder)
+	var nolb DataLogBuilder = new(NoOpLogBuilder)
 	var r LogBuilder
 	if r = nolb.SetEvent("event"); r != nolb {
 		t.Error("SetEvent did not return nolb")
@@ -36,6 +37,18 @@ func TestNoOpLogBuilder(t *testing.T) {
 	if r = nolb.AddData("k", "v"); r != nolb {
 		t.Error("AddData did not return nolb")
 	}
+	if r = nolb.AddDataFunc("k", func() interface{} { return "v" }); r != nolb {
+		t.Error("AddDataFunc did not return nolb")
+	}
+	if r = nolb.AddDataRaw("k", json.RawMessage(`"v"`)); r != nolb {
+		t.Error("AddDataRaw did not return nolb")
+	}
+	if r = nolb.SetDataJSON([]byte(`{"k":"v"}`)); r != nolb {
+		t.Error("SetDataJSON did not return nolb")
+	}
+	if r = nolb.SetDataObject(struct{ K string }{"v"}); r != nolb {
+		t.Error("SetDataObject did not return nolb")
+	}
 	if r = nolb.AddContext("k", "v"); r != nolb {
 		t.Error("AddData did not return nolb")
 	}
@@ -0,0 +1,231 @@
+/*
+Copyright 2016 Ville Koskela
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package gosteno
+
+import (
+	"reflect"
+	"sort"
+	"github.com/Sirupsen/logrus"
+)
+
+const (
+	EVENT_DATA_OBJECT_KEY string = "object"
+)
+
+var (
+	_ Marker = (*ObjectMarker)(nil)
+
+	// Cache of the logged fields by struct type.
+	objectFieldsCache cacheMap
+)
+
+// Object marker implementation; the exported fields of a struct are logged as data. Fields are configured with the
+// steno tag (e.g. `steno:"name,omitempty,redact,context"`):
+//
+//	name      - the key of the field; the default is the name in the json tag, if any, or else the field name
+//	omitempty - omit the field if it has an empty value (e.g. zero, empty string, nil or empty collection)
+//	redact    - render the value as a Secret (e.g. "***")
+//	context   - log the field in context instead of data
+//
+// A field tagged "-", or without a steno tag and with a json tag of "-", is omitted and the fields of embedded structs
+// without a name are promoted. Data and context added explicitly take precedence over fields with the same key. A value
+// other than a struct (or pointer to one) is logged as data under the "object" key.
+type ObjectMarker struct { }
+
+// A field of a struct logged as data or context.
+type objectField struct {
+	name string
+	index []int
+	omitEmpty bool
+	redact bool
+	context bool
+}
+
+// Object fields sorted by decreasing depth of embedding.
+type objectFieldsByDepth []objectField
+
+func (of objectFieldsByDepth) Len() int {
+	return len(of)
+}
+
+func (of objectFieldsByDepth) Less(i int, j int) bool {
+	return len(of[i].index) > len(of[j].index)
+}
+
+func (of objectFieldsByDepth) Swap(i int, j int) {
+	of[i], of[j] = of[j], of[i]
+}
+
+// Encode.
+func (som *ObjectMarker) Encode(
+		logger *logrus.Logger,
+		event string,
+		loggerName string,
+		object interface{},
+		data map[string]interface{},
+		context map[string]interface{},
+		err error) *logrus.Entry {
+
+	var s stack
+	if err != nil {
+		s = captureStack(1)
+	}
+	return som.encode(logger, event, loggerName, object, data, context, err, s)
+}
+
+func (som *ObjectMarker) encode(
+		logger *logrus.Logger,
+		event string,
+		loggerName string,
+		object interface{},
+		data map[string]interface{},
+		context map[string]interface{},
+		err error,
+		s stack) *logrus.Entry {
+
+	var entry *logrus.Entry = logrus.NewEntry(logger).WithFields(logrus.Fields{
+		MarkerKey: som,
+		EVENT_DATA_EVENT_KEY: event,
+		EVENT_DATA_LOGGER_KEY: loggerName,
+		EVENT_DATA_OBJECT_KEY: object,
+		EVENT_DATA_DATA_KEY: data,
+		EVENT_DATA_CONTEXT_KEY: context,
+		EVENT_DATA_ERROR_KEY: err,})
+	if s != nil {
+		entry.Data[StackKey] = s
+	}
+	return entry
+}
+
+// Parse event name from event.
+func (som *ObjectMarker) ParseEvent(e *logrus.Entry) string {
+	v, _ := e.Data[EVENT_DATA_EVENT_KEY].(string)
+	return v
+}
+
+// Parse logger name from event.
+func (som *ObjectMarker) ParseLoggerName(e *logrus.Entry) string {
+	v, _ := e.Data[EVENT_DATA_LOGGER_KEY].(string)
+	return v
+}
+
+// Parse data from event; the fields of the object not routed to context and the explicit data.
+func (som *ObjectMarker) ParseData(e *logrus.Entry) map[string]interface{} {
+	explicit, _ := e.Data[EVENT_DATA_DATA_KEY].(map[string]interface{})
+	return parseObjectFields(e.Data[EVENT_DATA_OBJECT_KEY], false, explicit)
+}
+
+// Parse context from event; the fields of the object routed to context and the explicit context.
+func (som *ObjectMarker) ParseContext(e *logrus.Entry) map[string]interface{} {
+	explicit, _ := e.Data[EVENT_DATA_CONTEXT_KEY].(map[string]interface{})
+	return parseObjectFields(e.Data[EVENT_DATA_OBJECT_KEY], true, explicit)
+}
+
+// Parse error from event.
+func (som *ObjectMarker) ParseError(e *logrus.Entry) error {
+	v, _ := e.Data[EVENT_DATA_ERROR_KEY].(error)
+	return v
+}
+
+// Return the fields of the object logged in context or in data merged with the explicit values.
+func parseObjectFields(object interface{}, context bool, explicit map[string]interface{}) map[string]interface{} {
+	var v reflect.Value = reflect.ValueOf(object)
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	var result map[string]interface{} = make(map[string]interface{}, len(explicit))
+	if v.Kind() == reflect.Struct {
+		for _, field := range getObjectFields(v.Type()) {
+			if field.context != context {
+				continue
+			}
+			fieldValue, ok := fieldByIndex(v, field.index)
+			if !ok || !fieldValue.CanInterface() || field.omitEmpty && isEmptyValue(fieldValue) {
+				continue
+			}
+			if field.redact {
+				result[field.name] = Secret(fieldValue.Interface())
+			} else {
+				result[field.name] = fieldValue.Interface()
+			}
+		}
+	} else if object != nil && !context && !(v.Kind() == reflect.Ptr && v.IsNil()) {
+		result[EVENT_DATA_OBJECT_KEY] = object
+	}
+	for key, value := range explicit {
+		result[key] = value
+	}
+	return result
+}
+
+// Return the logged fields of the struct type.
+func getObjectFields(t reflect.Type) []objectField {
+	if fields, ok := objectFieldsCache.load(t); ok {
+		return fields.([]objectField)
+	}
+	var fields []objectField = collectObjectFields(t, nil, map[reflect.Type]bool{})
+
+	// Fields of embedded structs are ordered first such that shallower fields with the same name take precedence
+	sort.Stable(objectFieldsByDepth(fields))
+	objectFieldsCache.store(t, fields)
+	return fields
+}
+
+// Return the logged fields of the struct type and its embedded structs; visited holds the embedded types on the path to
+// the type such that only a type embedding itself is skipped.
+func collectObjectFields(t reflect.Type, index []int, visited map[reflect.Type]bool) []objectField {
+	if visited[t] {
+		return nil
+	}
+	visited[t] = true
+	defer delete(visited, t)
+	var fields []objectField
+	for i := 0; i < t.NumField(); i++ {
+		var field reflect.StructField = t.Field(i)
+		if field.PkgPath != "" && !(field.Anonymous && field.Type.Kind() == reflect.Struct) {
+			// Fields of embedded unexported structs are promoted but not those of pointers to them
+			continue
+		}
+		var tag string = field.Tag.Get("steno")
+		var jsonTag string = field.Tag.Get("json")
+		if tag == "-" || tag == "" && jsonTag == "-" {
+			continue
+		}
+		name, options := splitTag(tag)
+		var fieldIndex []int = append(append([]int(nil), index...), i)
+		if name == "" && field.Anonymous && derefType(field.Type).Kind() == reflect.Struct {
+			fields = append(fields, collectObjectFields(derefType(field.Type), fieldIndex, visited)...)
+			continue
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		if name == "" && jsonTag != "-" {
+			name, _ = splitTag(jsonTag)
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields = append(fields, objectField{
+			name: name,
+			index: fieldIndex,
+			omitEmpty: hasTagOption(options, "omitempty"),
+			redact: hasTagOption(options, "redact"),
+			context: hasTagOption(options, "context"),
+		})
+	}
+	return fields
+}
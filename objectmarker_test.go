@@ -0,0 +1,172 @@
+/*
+Copyright 2016 Ville Koskela
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package gosteno
+
+import (
+	"reflect"
+	"testing"
+	"github.com/Sirupsen/logrus"
+)
+
+type testAudit struct {
+	Actor string `steno:"actor"`
+	Shadowed string `steno:"id"`
+}
+
+type testRequest struct {
+	testAudit
+	Id string `steno:"id"`
+	Method string `json:"method"`
+	Path string
+	Password string `steno:"password,redact"`
+	Token string `steno:",omitempty,redact"`
+	RequestId string `steno:"requestId,context"`
+	Retries int `steno:"retries,omitempty"`
+	Ignored string `steno:"-"`
+	internal string
+}
+
+type testJsonTagged struct {
+	Ignored string `json:"-"`
+	Dash string `json:"-,"`
+	Included string `steno:",omitempty" json:"-"`
+}
+
+type testApproval struct {
+	Approver string `steno:"approver,omitempty"`
+}
+
+type testApprovedSource struct {
+	testApproval
+	Source string `steno:"source"`
+}
+
+type testApprovedTarget struct {
+	testApproval
+	Target string `steno:"target"`
+}
+
+type testTransfer struct {
+	testApprovedSource
+	testApprovedTarget
+}
+
+func TestObjectMarkerParse(t *testing.T) {
+	t.Parallel()
+	var om *ObjectMarker = new(ObjectMarker)
+	var request *testRequest = &testRequest{
+		testAudit: testAudit{Actor: "alice", Shadowed: "shadowed"},
+		Id: "1",
+		Method: "GET",
+		Path: "/",
+		Password: "hunter2",
+		RequestId: "abc",
+		Ignored: "ignored",
+		internal: "internal",
+	}
+	var e *logrus.Entry = om.Encode(
+		logger,
+		"my_event",
+		"my_logger",
+		request,
+		map[string]interface{}{"Path": "/explicit"},
+		map[string]interface{}{"host": "localhost"},
+		nil)
+	var expectedData map[string]interface{} = map[string]interface{}{
+		"actor": "alice",
+		"id": "1",
+		"method": "GET",
+		"Path": "/explicit",
+		"password": Secret("hunter2"),
+	}
+	if v := om.ParseData(e); !reflect.DeepEqual(v, expectedData) {
+		t.Errorf("ParseData failed; expected '%#v' instead actual '%#v'", expectedData, v)
+	}
+	var expectedContext map[string]interface{} = map[string]interface{}{"requestId": "abc", "host": "localhost"}
+	if v := om.ParseContext(e); !reflect.DeepEqual(v, expectedContext) {
+		t.Errorf("ParseContext failed; expected '%v' instead actual '%v'", expectedContext, v)
+	}
+	if v := om.ParseEvent(e); v != "my_event" {
+		t.Errorf("ParseEvent failed %s", v)
+	}
+	if v := om.ParseLoggerName(e); v != "my_logger" {
+		t.Errorf("ParseLoggerName failed %s", v)
+	}
+}
+
+func TestObjectMarkerParseJsonTagged(t *testing.T) {
+	t.Parallel()
+	var om *ObjectMarker = new(ObjectMarker)
+	var object *testJsonTagged = &testJsonTagged{Ignored: "ignored", Dash: "dash", Included: "included"}
+	var expectedData map[string]interface{} = map[string]interface{}{"-": "dash", "Included": "included"}
+	if v := om.ParseData(om.Encode(logger, "", "", object, nil, nil, nil)); !reflect.DeepEqual(v, expectedData) {
+		t.Errorf("ParseData failed; expected '%v' instead actual '%v'", expectedData, v)
+	}
+}
+
+func TestObjectMarkerParseNonStruct(t *testing.T) {
+	t.Parallel()
+	var om *ObjectMarker = new(ObjectMarker)
+	var nilRequest *testRequest
+	for _, object := range []interface{}{nil, nilRequest} {
+		if v := om.ParseData(om.Encode(logger, "", "", object, nil, nil, nil)); len(v) != 0 {
+			t.Errorf("ParseData failed; expected empty instead actual '%v'", v)
+		}
+	}
+	var expectedData map[string]interface{} = map[string]interface{}{"object": []int{1, 2}}
+	if v := om.ParseData(om.Encode(logger, "", "", []int{1, 2}, nil, nil, nil)); !reflect.DeepEqual(v, expectedData) {
+		t.Errorf("ParseData failed; expected '%v' instead actual '%v'", expectedData, v)
+	}
+	if v := om.ParseContext(emptyEntry); len(v) != 0 {
+		t.Errorf("ParseContext failed; expected empty instead actual '%v'", v)
+	}
+}
+
+func TestObjectMarkerParseSiblingEmbedded(t *testing.T) {
+	t.Parallel()
+	var om *ObjectMarker = new(ObjectMarker)
+	var transfer testTransfer = testTransfer{
+		testApprovedSource: testApprovedSource{Source: "a"},
+		testApprovedTarget: testApprovedTarget{testApproval: testApproval{Approver: "alice"}, Target: "b"},
+	}
+	var expectedData map[string]interface{} = map[string]interface{}{
+		"approver": "alice",
+		"source": "a",
+		"target": "b",
+	}
+	if v := om.ParseData(om.Encode(logger, "", "", transfer, nil, nil, nil)); !reflect.DeepEqual(v, expectedData) {
+		t.Errorf("ParseData failed; expected '%v' instead actual '%v'", expectedData, v)
+	}
+}
+
+func TestObjectMarkerFieldsCached(t *testing.T) {
+	var fields []objectField = getObjectFields(reflect.TypeOf((*testRequest)(nil)).Elem())
+	if cached := getObjectFields(reflect.TypeOf((*testRequest)(nil)).Elem()); &cached[0] != &fields[0] {
+		t.Errorf("Expected fields to be cached")
+	}
+}
+
+func TestFormatterDataObject(t *testing.T) {
+	t.Parallel()
+	logger, buffer := HelperTestGetLogger("TestFormatterDataObject", logrus.DebugLevel, NewFormatter())
+	logger.InfoBuilder().(DataLogBuilder).
+			SetDataObject(testRequest{Id: "1", Method: "GET", Path: "/", Password: "hunter2", Token: "xyz", RequestId: "abc", Retries: 2}).
+			SetEvent("my_event").
+			SetMessage("TestFormatterDataObject").
+			AddData("extra", true).
+			Log()
+	HelperTestVerifyIgnoreContext(t, buffer, formatterTestDataPath + "TestFormatterDataObject.expected.json", []string{"requestId"})
+}
@@ -0,0 +1,204 @@
+/*
+Copyright 2016 Ville Koskela
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package gosteno
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"path"
+	"regexp"
+)
+
+const (
+	// The default replacement of masked values.
+	defaultRedactionMask = "***"
+	// The maximum number of keys with a cached rule; keys beyond it are matched against the rules on each lookup.
+	maxResolvedRedactions = 4096
+)
+
+var (
+	// Pairs of key and value within a message (e.g. password=secret, token: "a b" or "ssn":"123").
+	messagePairPattern = regexp.MustCompile(`("?)([A-Za-z0-9_.\-]+)("?\s*[=:]\s*)("(?:[^"\\]|\\.)*"|[^\s,;&"]+)`)
+)
+
+type RedactionMode int
+
+const (
+	// Omit the key and value.
+	RedactionModeDrop RedactionMode = iota
+	// Replace the value with the mask (e.g. "***").
+	RedactionModeMask
+	// Replace the value with a keyed hash of it (e.g. "hmac-sha256:5d41..."); equal values have equal hashes allowing
+	// correlation without disclosing the value.
+	RedactionModeHash
+)
+
+// Redactor redacts values of data, context and exception data by key; keys are matched exactly, by glob (e.g.
+// "*_token") or by regular expression and the rules apply recursively to the keys of nested maps and the json field
+// names of nested structs. Key and value pairs within the message (e.g. "password=secret") are also redacted. Rules
+// are evaluated in the order added and the first matching rule applies. This should be configured before the
+// formatter is used.
+type Redactor struct {
+	rules []redactionRule
+	mask string
+	hashKey []byte
+	secretMode RedactionMode
+	resolved cacheMap
+}
+
+type redactionRule struct {
+	match func(key string) bool
+	mode RedactionMode
+}
+
+type resolvedRedaction struct {
+	rule *redactionRule
+}
+
+func NewRedactor() *Redactor {
+	return &Redactor{
+		mask: defaultRedactionMask,
+		secretMode: RedactionModeMask,
+		resolved: cacheMap{limit: maxResolvedRedactions},
+	}
+}
+
+// Redact values of the key.
+func (r *Redactor) AddKey(key string, mode RedactionMode) {
+	r.addRule(func(candidate string) bool { return candidate == key }, mode)
+}
+
+// Redact values of keys matching the glob pattern (see path.Match); e.g. "*password*".
+func (r *Redactor) AddGlob(pattern string, mode RedactionMode) error {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return err
+	}
+	r.addRule(func(candidate string) bool {
+		matched, _ := path.Match(pattern, candidate)
+		return matched
+	}, mode)
+	return nil
+}
+
+// Redact values of keys matching the regular expression; e.g. "(?i)^authorization$".
+func (r *Redactor) AddRegex(pattern string, mode RedactionMode) error {
+	expression, err := regexp.Compile(pattern)
+	if err != nil {
+		return err
+	}
+	r.addRule(expression.MatchString, mode)
+	return nil
+}
+
+func (r *Redactor) Mask() string {
+	return r.mask
+}
+
+// Set the replacement of values redacted with RedactionModeMask. The default is "***".
+func (r *Redactor) SetMask(v string) {
+	r.mask = v
+}
+
+// Set the key of the hash of values redacted with RedactionModeHash; the key should be secret otherwise values with
+// few possibilities (e.g. social security numbers) may be recovered from their hash. The default is empty.
+func (r *Redactor) SetHashKey(v []byte) {
+	r.hashKey = append([]byte(nil), v...)
+}
+
+func (r *Redactor) SecretMode() RedactionMode {
+	return r.secretMode
+}
+
+// Set the replacement of values wrapped with Secret; either RedactionModeMask or RedactionModeHash (RedactionModeDrop
+// is treated as RedactionModeMask). The default is RedactionModeMask.
+func (r *Redactor) SetSecretMode(v RedactionMode) {
+	r.secretMode = v
+}
+
+func (r *Redactor) addRule(match func(key string) bool, mode RedactionMode) {
+	r.rules = append(r.rules, redactionRule{match: match, mode: mode})
+	r.resolved.clear()
+}
+
+// Return the first rule matching the key of data, context or exception data; nil if none. The rule of the key is
+// cached until the cache is full.
+func (r *Redactor) lookup(key string) *redactionRule {
+	if resolved, ok := r.resolved.load(key); ok {
+		return resolved.(*resolvedRedaction).rule
+	}
+	var rule *redactionRule = r.match(key)
+	r.resolved.store(key, &resolvedRedaction{rule: rule})
+	return rule
+}
+
+// Return the first rule matching the key without caching it; nil if none.
+func (r *Redactor) match(key string) *redactionRule {
+	for i := range r.rules {
+		if r.rules[i].match(key) {
+			return &r.rules[i]
+		}
+	}
+	return nil
+}
+
+// Return the replacement of the value; strings are hashed as is and other values by their json encoding.
+func (r *Redactor) redact(mode RedactionMode, value interface{}) string {
+	if mode != RedactionModeHash {
+		return r.mask
+	}
+	var content []byte
+	if s, ok := value.(string); ok {
+		content = []byte(s)
+	} else if resolved, err := resolveLazy(value); err == nil {
+		content, _ = appendLimitedJsonValue(nil, resolved, valueLimits{})
+	}
+	return r.hash(content)
+}
+
+func (r *Redactor) hash(content []byte) string {
+	var mac hash.Hash = hmac.New(sha256.New, r.hashKey)
+	mac.Write(content)
+	return "hmac-sha256:" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Return the message with the values of key and value pairs matching a rule replaced; values dropped from the message
+// are masked. The keys within messages are arbitrary and so their rules are not cached.
+func (r *Redactor) redactMessage(message string) string {
+	if len(r.rules) == 0 {
+		return message
+	}
+	return messagePairPattern.ReplaceAllStringFunc(message, func(pair string) string {
+		var groups []string = messagePairPattern.FindStringSubmatch(pair)
+		var rule *redactionRule = r.match(groups[2])
+		if rule == nil {
+			return pair
+		}
+		var replacement string = r.mask
+		if rule.mode == RedactionModeHash {
+			var value string = groups[4]
+			if len(value) >= 2 && value[0] == '"' && value[len(value) - 1] == '"' {
+				value = value[1:len(value) - 1]
+			}
+			replacement = r.hash([]byte(value))
+		}
+		if groups[4][0] == '"' {
+			replacement = `"` + replacement + `"`
+		}
+		return groups[1] + groups[2] + groups[3] + replacement
+	})
+}
@@ -0,0 +1,213 @@
+/*
+Copyright 2016 Ville Koskela
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package gosteno
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"testing"
+	"github.com/Sirupsen/logrus"
+)
+
+type testCredentials struct {
+	User string `json:"user"`
+	Password string `json:"password"`
+	Token string `json:"api_token,omitempty"`
+	Nested map[string]interface{} `json:"nested"`
+}
+
+func TestRedactorInvalidPatterns(t *testing.T) {
+	var redactor *Redactor = NewRedactor()
+	if err := redactor.AddGlob("[", RedactionModeMask); err == nil {
+		t.Error("Expected error for invalid glob")
+	}
+	if err := redactor.AddRegex("(", RedactionModeMask); err == nil {
+		t.Error("Expected error for invalid regex")
+	}
+	if len(redactor.rules) != 0 {
+		t.Errorf("Invalid patterns added rules %v", redactor.rules)
+	}
+}
+
+func TestRedactorRuleOrder(t *testing.T) {
+	var redactor *Redactor = NewRedactor()
+	redactor.AddKey("password", RedactionModeMask)
+	if rule := redactor.lookup("password_hint"); rule != nil {
+		t.Errorf("Unexpected match %v", rule)
+	}
+	redactor.AddGlob("password*", RedactionModeDrop)
+	if rule := redactor.lookup("password_hint"); rule == nil || rule.mode != RedactionModeDrop {
+		t.Errorf("Incorrect rule for password_hint %v", rule)
+	}
+	if rule := redactor.lookup("password"); rule == nil || rule.mode != RedactionModeMask {
+		t.Errorf("Incorrect rule for password %v", rule)
+	}
+}
+
+func TestRedactorCache(t *testing.T) {
+	t.Parallel()
+	var redactor *Redactor = NewRedactor()
+	redactor.AddKey("password", RedactionModeMask)
+	redactor.redactMessage("user=alice password=secret")
+	if _, ok := redactor.resolved.load("user"); ok {
+		t.Error("Unexpected cache of key within message")
+	}
+	for i := 0; i < maxResolvedRedactions + 10; i++ {
+		redactor.lookup(strconv.Itoa(i))
+	}
+	if v := redactor.resolved.size(); v != maxResolvedRedactions {
+		t.Errorf("Incorrect number of cached keys %d", v)
+	}
+	if rule := redactor.lookup("password"); rule == nil || rule.mode != RedactionModeMask {
+		t.Errorf("Incorrect rule for password beyond cache %v", rule)
+	}
+	redactor.AddKey("user", RedactionModeDrop)
+	if v := redactor.resolved.size(); v != 0 {
+		t.Errorf("Cache not cleared when adding rule %d", v)
+	}
+}
+
+func TestFormatterRedactor(t *testing.T) {
+	t.Parallel()
+	var formatter *Formatter = NewFormatter()
+	var redactor *Redactor = helperTestGetRedactor(t)
+	formatter.SetRedactor(redactor)
+	logger, buffer := HelperTestGetLogger("TestFormatterRedactor", logrus.DebugLevel, formatter)
+	logger.InfoBuilder().
+			SetMessage("TestFormatterRedactor").
+			AddData("password", "hunter2").
+			AddData("Authorization", "Bearer abc").
+			AddData("ssn", "123-45-6789").
+			AddData("user", "alice").
+			AddData("request", map[string]interface{}{
+				"headers": map[string]string{"authorization": "Bearer abc", "accept": "*/*"},
+				"body": []interface{}{testCredentials{
+					User: "alice",
+					Password: "hunter2",
+					Token: "xyz",
+					Nested: map[string]interface{}{"ssn": "123-45-6789"},
+				}},
+			}).
+			AddContext("session_token", "xyz").
+			Log()
+	var event map[string]map[string]interface{}
+	helperTestUnmarshalBlocks(t, buffer.Bytes(), &event)
+	var hash string = redactor.hash([]byte("123-45-6789"))
+	helperTestVerifyLimitedValue(t, event["data"], "password", `"***"`)
+	helperTestVerifyLimitedValue(t, event["data"], "Authorization", `"***"`)
+	helperTestVerifyLimitedValue(t, event["data"], "ssn", `"` + hash + `"`)
+	helperTestVerifyLimitedValue(t, event["data"], "user", `"alice"`)
+	helperTestVerifyLimitedValue(
+		t,
+		event["data"],
+		"request",
+		`{"body":[{"nested":{"ssn":"` + hash + `"},"password":"***","user":"alice"}],"headers":{"accept":"*/*","authorization":"***"}}`)
+	if _, ok := event["context"]["session_token"]; ok {
+		t.Errorf("Expected session_token to be dropped from context %v", event["context"])
+	}
+}
+
+func TestFormatterRedactorMessage(t *testing.T) {
+	t.Parallel()
+	var formatter *Formatter = NewFormatter()
+	var redactor *Redactor = helperTestGetRedactor(t)
+	formatter.SetRedactor(redactor)
+	logger, buffer := HelperTestGetLogger("TestFormatterRedactorMessage", logrus.DebugLevel, formatter)
+	logger.Infof(`login user=alice password=hunter2, session_token: "a b"; ssn=123-45-6789 {"password":"x"}`)
+	var event map[string]map[string]interface{}
+	helperTestUnmarshalBlocks(t, buffer.Bytes(), &event)
+	var expected string = `login user=alice password=***, session_token: "***"; ssn=` + redactor.hash([]byte("123-45-6789")) +
+			` {"password":"***"}`
+	if v := event["data"]["message"]; v != expected {
+		t.Errorf("Incorrect message; expected %s but was %v", expected, v)
+	}
+}
+
+func TestFormatterRedactorRawFields(t *testing.T) {
+	t.Parallel()
+	var formatter *Formatter = NewFormatter()
+	formatter.SetRedactor(helperTestGetRedactor(t))
+	var buffer *bytes.Buffer = new(bytes.Buffer)
+	var logrusLogger *logrus.Logger = &logrus.Logger{
+		Out: buffer,
+		Formatter: formatter,
+		Level: logrus.DebugLevel,
+	}
+	logrusLogger.WithFields(logrus.Fields{
+		"password": "hunter2",
+		"session_token": "xyz",
+		"credentials": &testCredentials{User: "alice", Password: "hunter2"},
+	}).Info("TestFormatterRedactorRawFields")
+	var event map[string]map[string]interface{}
+	helperTestUnmarshalBlocks(t, buffer.Bytes(), &event)
+	helperTestVerifyLimitedValue(t, event["data"], "password", `"***"`)
+	helperTestVerifyLimitedValue(t, event["data"], "credentials", `{"nested":null,"password":"***","user":"alice"}`)
+	if _, ok := event["data"]["session_token"]; ok {
+		t.Errorf("Expected session_token to be dropped from data %v", event["data"])
+	}
+}
+
+func TestFormatterRedactorExceptionData(t *testing.T) {
+	t.Parallel()
+	var formatter *Formatter = NewFormatter()
+	formatter.SetRedactor(helperTestGetRedactor(t))
+	logger, buffer := HelperTestGetLogger("TestFormatterRedactorExceptionData", logrus.DebugLevel, formatter)
+	logger.InfoBuilder().
+			SetMessage("TestFormatterRedactorExceptionData").
+			SetError(&testDataError{testDomainError{"This is an error"}, map[string]interface{}{"password": "hunter2", "retries": 3}, nil}).
+			Log()
+	var root struct {
+		Exception struct {
+			Data map[string]interface{} `json:"data"`
+		} `json:"exception"`
+	}
+	if err := json.Unmarshal(buffer.Bytes(), &root); err != nil {
+		t.Fatalf("Unmarshal failed because %v in buffer %s", err, buffer.String())
+	}
+	helperTestVerifyLimitedValue(t, root.Exception.Data, "password", `"***"`)
+	helperTestVerifyLimitedValue(t, root.Exception.Data, "retries", `3`)
+}
+
+func TestFormatterRedactorHashKey(t *testing.T) {
+	var redactor *Redactor = NewRedactor()
+	var unkeyed string = redactor.hash([]byte("value"))
+	redactor.SetHashKey([]byte("secret"))
+	var keyed string = redactor.hash([]byte("value"))
+	if unkeyed == keyed {
+		t.Errorf("Expected hash to depend on key %s", keyed)
+	}
+	if keyed != redactor.hash([]byte("value")) || keyed == redactor.hash([]byte("other")) {
+		t.Errorf("Expected hash to be deterministic %s", keyed)
+	}
+	if v := redactor.redact(RedactionModeHash, 42); v != redactor.hash([]byte("42")) {
+		t.Errorf("Incorrect hash of number %s", v)
+	}
+}
+
+func helperTestGetRedactor(t *testing.T) *Redactor {
+	var redactor *Redactor = NewRedactor()
+	redactor.AddKey("password", RedactionModeMask)
+	redactor.AddKey("ssn", RedactionModeHash)
+	if err := redactor.AddRegex("(?i)^authorization$", RedactionModeMask); err != nil {
+		t.Fatal(err)
+	}
+	if err := redactor.AddGlob("*_token", RedactionModeDrop); err != nil {
+		t.Fatal(err)
+	}
+	redactor.SetHashKey([]byte("TestKey"))
+	return redactor
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2016 Ville Koskela
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package gosteno
+
+import (
+	"fmt"
+	"reflect"
+)
+
+var (
+	secretValueType = reflect.TypeOf((*SecretValue)(nil)).Elem()
+)
+
+// SecretValue is a value that is never rendered in clear; it is rendered as "***" by the formatters (or as a keyed hash
+// if so configured with Redactor.SetSecretMode), by fmt (e.g. in Printf style messages) and by encoding/json (e.g.
+// nested within other data values).
+type SecretValue struct {
+	value interface{}
+}
+
+// Secret returns the value wrapped such that it is never rendered in clear.
+func Secret(value interface{}) SecretValue {
+	return SecretValue{value: value}
+}
+
+// Reveal returns the wrapped value; for example, to use the value other than for logging.
+func (sv SecretValue) Reveal() interface{} {
+	return sv.value
+}
+
+func (sv SecretValue) String() string {
+	return defaultRedactionMask
+}
+
+func (sv SecretValue) GoString() string {
+	return defaultRedactionMask
+}
+
+// Format renders the mask for all verbs and flags (e.g. %v, %+v, %#v, %s, %q and %d).
+func (sv SecretValue) Format(f fmt.State, verb rune) {
+	f.Write([]byte(defaultRedactionMask))
+}
+
+func (sv SecretValue) MarshalJSON() ([]byte, error) {
+	return appendJsonString(nil, defaultRedactionMask), nil
+}
+
+func (sv SecretValue) MarshalText() ([]byte, error) {
+	return []byte(defaultRedactionMask), nil
+}
+
+// Return the secret if the value is a secret or a non-nil pointer to one.
+func asSecret(value interface{}) (SecretValue, bool) {
+	switch v := value.(type) {
+	case SecretValue:
+		return v, true
+	case *SecretValue:
+		if v != nil {
+			return *v, true
+		}
+	}
+	return SecretValue{}, false
+}
+
+// Return the replacement of the secret; the mask unless the redactor renders secrets as hashes.
+func (r *Redactor) redactSecret(secret SecretValue) string {
+	if r == nil {
+		return defaultRedactionMask
+	}
+	if r.secretMode == RedactionModeHash {
+		return r.redact(RedactionModeHash, secret.value)
+	}
+	return r.redact(RedactionModeMask, nil)
+}
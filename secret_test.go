@@ -0,0 +1,140 @@
+/*
+Copyright 2016 Ville Koskela
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package gosteno
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"github.com/Sirupsen/logrus"
+)
+
+type testAccount struct {
+	User string `json:"user"`
+	Password SecretValue `json:"password"`
+	Pin *SecretValue `json:"pin"`
+}
+
+func TestSecretFmt(t *testing.T) {
+	var secret SecretValue = Secret("hunter2")
+	for _, format := range []string{"%v", "%+v", "%#v", "%s", "%q", "%d", "%x", "%10v"} {
+		if v := fmt.Sprintf(format, secret); v != "***" {
+			t.Errorf("Secret rendered by %s as %s", format, v)
+		}
+		if v := fmt.Sprintf(format, &secret); v != "***" {
+			t.Errorf("Secret pointer rendered by %s as %s", format, v)
+		}
+	}
+	if v := fmt.Sprint(secret); v != "***" {
+		t.Errorf("Secret rendered as %s", v)
+	}
+	if v := fmt.Sprintf("%+v", testAccount{User: "alice", Password: secret}); strings.Contains(v, "hunter2") {
+		t.Errorf("Secret rendered within struct as %s", v)
+	}
+	if v := secret.Reveal(); v != "hunter2" {
+		t.Errorf("Incorrect revealed value %v", v)
+	}
+}
+
+func TestSecretJson(t *testing.T) {
+	var pin SecretValue = Secret(1234)
+	jsonBytes, err := json.Marshal(testAccount{User: "alice", Password: Secret("hunter2"), Pin: &pin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := string(jsonBytes); v != `{"user":"alice","password":"***","pin":"***"}` {
+		t.Errorf("Incorrect json encoding %s", v)
+	}
+}
+
+func TestFormatterSecret(t *testing.T) {
+	t.Parallel()
+	var formatter *Formatter = NewFormatter()
+	logger, buffer := HelperTestGetLogger("TestFormatterSecret", logrus.DebugLevel, formatter)
+	var pin SecretValue = Secret(1234)
+	logger.InfoBuilder().(DataLogBuilder).
+			AddDataFunc("lazy", func() interface{} { return Secret("hunter2") }).
+			SetMessage(fmt.Sprintf("Login with %v", Secret("hunter2"))).
+			AddData("password", Secret("hunter2")).
+			AddData("pin", &pin).
+			AddData("account", testAccount{User: "alice", Password: Secret("hunter2")}).
+			AddData("accounts", map[string]interface{}{"alice": []interface{}{Secret("hunter2")}}).
+			Log()
+	var event map[string]map[string]interface{}
+	helperTestUnmarshalBlocks(t, buffer.Bytes(), &event)
+	helperTestVerifyLimitedValue(t, event["data"], "message", `"Login with ***"`)
+	helperTestVerifyLimitedValue(t, event["data"], "password", `"***"`)
+	helperTestVerifyLimitedValue(t, event["data"], "pin", `"***"`)
+	helperTestVerifyLimitedValue(t, event["data"], "account", `{"password":"***","pin":null,"user":"alice"}`)
+	helperTestVerifyLimitedValue(t, event["data"], "accounts", `{"alice":["***"]}`)
+	helperTestVerifyLimitedValue(t, event["data"], "lazy", `"***"`)
+	if bytes.Contains(buffer.Bytes(), []byte("hunter2")) {
+		t.Errorf("Secret rendered in clear %s", buffer.String())
+	}
+}
+
+func TestFormatterSecretHash(t *testing.T) {
+	t.Parallel()
+	var formatter *Formatter = NewFormatter()
+	var redactor *Redactor = NewRedactor()
+	redactor.SetHashKey([]byte("TestKey"))
+	redactor.SetSecretMode(RedactionModeHash)
+	formatter.SetRedactor(redactor)
+	formatter.SetMaxDepth(8)
+	logger, buffer := HelperTestGetLogger("TestFormatterSecretHash", logrus.DebugLevel, formatter)
+	logger.InfoBuilder().
+			SetMessage("TestFormatterSecretHash").
+			AddData("password", Secret("hunter2")).
+			AddData("account", testAccount{User: "alice", Password: Secret("hunter2")}).
+			Log()
+	var event map[string]map[string]interface{}
+	helperTestUnmarshalBlocks(t, buffer.Bytes(), &event)
+	var hash string = redactor.hash([]byte("hunter2"))
+	helperTestVerifyLimitedValue(t, event["data"], "password", `"` + hash + `"`)
+	helperTestVerifyLimitedValue(t, event["data"], "account", `{"password":"` + hash + `","pin":null,"user":"alice"}`)
+}
+
+func TestFormattersSecret(t *testing.T) {
+	t.Parallel()
+	for _, formatter := range []logrus.Formatter{
+		NewConsoleFormatter(),
+		NewLogfmtFormatter(),
+		NewMsgpackFormatter(),
+		NewCBORFormatter(),
+	} {
+		var buffer *bytes.Buffer = new(bytes.Buffer)
+		var logrusLogger *logrus.Logger = &logrus.Logger{
+			Out: buffer,
+			Formatter: formatter,
+			Level: logrus.DebugLevel,
+		}
+		var logger *Logger = GetLoggerForLogger("TestFormattersSecret", logrusLogger)
+		logger.InfoBuilder().
+				SetMessage(fmt.Sprint("Login with ", Secret("hunter2"))).
+				AddData("password", Secret("hunter2")).
+				AddData("account", testAccount{User: "alice", Password: Secret("hunter2")}).
+				AddContext("token", Secret("hunter2")).
+				Log()
+		if bytes.Contains(buffer.Bytes(), []byte("hunter2")) {
+			t.Errorf("Secret rendered in clear by %T %q", formatter, buffer.String())
+		}
+		if !bytes.Contains(buffer.Bytes(), []byte("***")) {
+			t.Errorf("Secret not masked by %T %q", formatter, buffer.String())
+		}
+	}
+}
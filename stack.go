@@ -0,0 +1,132 @@
+/*
+Copyright 2016 Ville Koskela
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package gosteno
+
+import (
+	"bytes"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+const (
+	maxStackDepth = 64
+	defaultBacktraceDepth = 32
+)
+
+var (
+	// The package path of gosteno (e.g. github.com/vjkoskela/gosteno).
+	packagePath = reflect.TypeOf(Formatter{}).PkgPath()
+
+	// Function name prefixes of frames internal to logging; gosteno test functions are not considered internal.
+	internalFrames = []string{
+		packagePath + ".",
+		"github.com/Sirupsen/logrus.",
+		"github.com/sirupsen/logrus.",
+	}
+
+	// Function name prefixes of frames that are excluded from backtraces by default; the frames internal to logging.
+	defaultBacktraceFilters = append([]string(nil), internalFrames...)
+)
+
+// The call stack captured when an error is handed to gosteno.
+type stack []uintptr
+
+// A frame of a call stack.
+type stackFrame struct {
+	function string
+	file string
+	line int
+}
+
+// Capture the call stack of the caller; skip is the number of additional frames to skip above the caller.
+func captureStack(skip int) stack {
+	var pcs [maxStackDepth]uintptr
+	var n int = runtime.Callers(skip + 2, pcs[:])
+	var s stack = make(stack, n)
+	copy(s, pcs[:n])
+	return s
+}
+
+// Render the stack as Steno backtrace lines skipping frames matching any filter and limited to depth lines.
+func (s stack) backtrace(depth int, filters []string) []string {
+	var lines []string = make([]string, 0, depth)
+	if len(s) == 0 || depth <= 0 {
+		return lines
+	}
+	walkFrames(s, func(frame stackFrame) bool {
+		if frame.function != "" && !isFilteredFrame(frame.function, filters) {
+			lines = append(lines, frame.function + "(" + frame.file + ":" + strconv.Itoa(frame.line) + ")")
+		}
+		return len(lines) < depth
+	})
+	return lines
+}
+
+// Find the first frame outside of gosteno and logrus skipping an additional number of frames (e.g. wrapper libraries).
+func findCaller(skip int) (stackFrame, bool) {
+	var pcs [maxStackDepth]uintptr
+	var n int = runtime.Callers(2, pcs[:])
+	var caller stackFrame
+	var found bool = false
+	walkFrames(pcs[:n], func(frame stackFrame) bool {
+		if frame.function != "" && !isInternalFrame(frame) {
+			if skip <= 0 {
+				caller, found = frame, true
+				return false
+			}
+			skip--
+		}
+		return true
+	})
+	return caller, found
+}
+
+func isInternalFrame(frame stackFrame) bool {
+	return isFilteredFrame(frame.function, internalFrames) && !strings.HasSuffix(frame.file, "_test.go")
+}
+
+// Split a fully qualified function name (e.g. github.com/acme/billing.(*Invoice).Total) into its package path (e.g.
+// github.com/acme/billing) and method (e.g. (*Invoice).Total). Dots in the last element of the package path are escaped
+// by the runtime (e.g. gopkg.in/yaml%2ev2).
+func splitFunctionName(function string) (namespace string, method string) {
+	var start int = strings.LastIndex(function, "/") + 1
+	if dot := strings.Index(function[start:], "."); dot >= 0 {
+		return strings.Replace(function[:start + dot], "%2e", ".", -1), function[start + dot + 1:]
+	}
+	return "", function
+}
+
+// Return the identifier of the current goroutine as reported in the header of its stack trace (e.g. goroutine 18).
+func goroutineId() string {
+	var buffer [64]byte
+	var header []byte = buffer[:runtime.Stack(buffer[:], false)]
+	header = bytes.TrimPrefix(header, []byte("goroutine "))
+	if end := bytes.IndexByte(header, ' '); end > 0 {
+		return string(header[:end])
+	}
+	return "<UNKNOWN>"
+}
+
+func isFilteredFrame(function string, filters []string) bool {
+	for _, filter := range filters {
+		if strings.HasPrefix(function, filter) {
+			return true
+		}
+	}
+	return false
+}
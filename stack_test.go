@@ -0,0 +1,46 @@
+/*
+Copyright 2016 Ville Koskela
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package gosteno
+
+import (
+	"testing"
+)
+
+func TestSplitFunctionName(t *testing.T) {
+	t.Parallel()
+	var cases = [][]string{
+		{"github.com/acme/billing.(*Invoice).Total", "github.com/acme/billing", "(*Invoice).Total"},
+		{"github.com/acme/billing.process.func1", "github.com/acme/billing", "process.func1"},
+		{"gopkg.in/yaml%2ev2.Marshal", "gopkg.in/yaml.v2", "Marshal"},
+		{"main.main", "main", "main"},
+	}
+	for _, c := range cases {
+		if namespace, method := splitFunctionName(c[0]); namespace != c[1] || method != c[2] {
+			t.Errorf("Incorrect split of %s into namespace %s and method %s", c[0], namespace, method)
+		}
+	}
+}
+
+func TestStackBacktraceDepth(t *testing.T) {
+	t.Parallel()
+	var s stack = captureStack(0)
+	if backtrace := s.backtrace(2, []string{}); len(backtrace) != 2 {
+		t.Errorf("Backtrace not limited to depth %v", backtrace)
+	}
+	if backtrace := s.backtrace(0, []string{}); len(backtrace) != 0 {
+		t.Errorf("Backtrace not empty for zero depth %v", backtrace)
+	}
+}
@@ -0,0 +1,168 @@
+/*
+Copyright 2016 Ville Koskela
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package gosteno
+
+import (
+	"encoding"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// ValueEncoder replaces a data, context or exception data value with the value to encode in its place (e.g. a duration
+// with its string representation). A value failing to encode is isolated as a placeholder.
+type ValueEncoder func(value interface{}) (interface{}, error)
+
+// Registry of value encoders by type; a value is encoded by the encoder registered for its dynamic type or else by the
+// first encoder registered for an interface type it implements.
+type encoderRegistry struct {
+	encoders map[reflect.Type]ValueEncoder
+	interfaces []reflect.Type
+	resolved cacheMap
+}
+
+type resolvedEncoder struct {
+	encoder ValueEncoder
+}
+
+func newEncoderRegistry() *encoderRegistry {
+	return &encoderRegistry{encoders: make(map[reflect.Type]ValueEncoder)}
+}
+
+// Return a copy of the registry with the encoder registered for the type; a nil encoder removes the registration.
+func (er *encoderRegistry) with(t reflect.Type, encoder ValueEncoder) *encoderRegistry {
+	var result *encoderRegistry = newEncoderRegistry()
+	if er != nil {
+		for registeredType, registeredEncoder := range er.encoders {
+			result.encoders[registeredType] = registeredEncoder
+		}
+		for _, registeredType := range er.interfaces {
+			if registeredType != t {
+				result.interfaces = append(result.interfaces, registeredType)
+			}
+		}
+	}
+	delete(result.encoders, t)
+	if encoder != nil {
+		result.encoders[t] = encoder
+		if t.Kind() == reflect.Interface {
+			result.interfaces = append(result.interfaces, t)
+		}
+	}
+	return result
+}
+
+func (er *encoderRegistry) lookup(t reflect.Type) ValueEncoder {
+	if resolved, ok := er.resolved.load(t); ok {
+		return resolved.(*resolvedEncoder).encoder
+	}
+	var encoder ValueEncoder = er.encoders[t]
+	if encoder == nil {
+		for _, interfaceType := range er.interfaces {
+			if t.Implements(interfaceType) {
+				encoder = er.encoders[interfaceType]
+				break
+			}
+		}
+	}
+	er.resolved.store(t, &resolvedEncoder{encoder: encoder})
+	return encoder
+}
+
+// Invoke the encoder; an encoder panicking is reported as a failure.
+func callEncoder(encoder ValueEncoder, value interface{}) (result interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = nil
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return encoder(value)
+}
+
+// EncodeDurationString encodes a time.Duration as its string representation (e.g. "1.5s").
+func EncodeDurationString(value interface{}) (interface{}, error) {
+	if d, ok := value.(time.Duration); ok {
+		return d.String(), nil
+	}
+	return nil, unexpectedTypeError(value, "time.Duration")
+}
+
+// EncodeDurationMillis encodes a time.Duration as a number of milliseconds (e.g. 1500.25).
+func EncodeDurationMillis(value interface{}) (interface{}, error) {
+	if d, ok := value.(time.Duration); ok {
+		return float64(d) / float64(time.Millisecond), nil
+	}
+	return nil, unexpectedTypeError(value, "time.Duration")
+}
+
+// EncodeErrorMessage encodes an error as its message.
+func EncodeErrorMessage(value interface{}) (interface{}, error) {
+	if err, ok := value.(error); ok {
+		return err.Error(), nil
+	}
+	return nil, unexpectedTypeError(value, "error")
+}
+
+// EncodeBytesBase64 encodes a byte slice as a base64 string; this is consistent with encoding/json.
+func EncodeBytesBase64(value interface{}) (interface{}, error) {
+	if b, ok := value.([]byte); ok {
+		return base64.StdEncoding.EncodeToString(b), nil
+	}
+	return nil, unexpectedTypeError(value, "[]byte")
+}
+
+// EncodeBytesHex encodes a byte slice as a hexadecimal string.
+func EncodeBytesHex(value interface{}) (interface{}, error) {
+	if b, ok := value.([]byte); ok {
+		return hex.EncodeToString(b), nil
+	}
+	return nil, unexpectedTypeError(value, "[]byte")
+}
+
+// EncodeBytesString encodes a byte slice as a string; invalid UTF-8 is replaced.
+func EncodeBytesString(value interface{}) (interface{}, error) {
+	if b, ok := value.([]byte); ok {
+		return string(b), nil
+	}
+	return nil, unexpectedTypeError(value, "[]byte")
+}
+
+// EncodeStringer encodes a fmt.Stringer as its string representation.
+func EncodeStringer(value interface{}) (interface{}, error) {
+	if s, ok := value.(fmt.Stringer); ok {
+		return s.String(), nil
+	}
+	return nil, unexpectedTypeError(value, "fmt.Stringer")
+}
+
+// EncodeText encodes an encoding.TextMarshaler as its text representation.
+func EncodeText(value interface{}) (interface{}, error) {
+	if m, ok := value.(encoding.TextMarshaler); ok {
+		text, err := m.MarshalText()
+		if err != nil {
+			return nil, err
+		}
+		return string(text), nil
+	}
+	return nil, unexpectedTypeError(value, "encoding.TextMarshaler")
+}
+
+func unexpectedTypeError(value interface{}, expected string) error {
+	return fmt.Errorf("gosteno: cannot encode %T as %s", value, expected)
+}
@@ -0,0 +1,194 @@
+/*
+Copyright 2016 Ville Koskela
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package gosteno
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+	"github.com/Sirupsen/logrus"
+)
+
+type testStringer struct {
+	Name string
+}
+
+func (ts testStringer) String() string {
+	return "stringer:" + ts.Name
+}
+
+func TestValueEncoders(t *testing.T) {
+	var cases []struct {
+		encoder ValueEncoder
+		value interface{}
+		expected interface{}
+	} = []struct {
+		encoder ValueEncoder
+		value interface{}
+		expected interface{}
+	}{
+		{EncodeDurationString, 1500 * time.Millisecond, "1.5s"},
+		{EncodeDurationMillis, 1500250 * time.Microsecond, 1500.25},
+		{EncodeErrorMessage, errors.New("failure"), "failure"},
+		{EncodeBytesBase64, []byte{0x01, 0xff}, "Af8="},
+		{EncodeBytesHex, []byte{0x01, 0xff}, "01ff"},
+		{EncodeBytesString, []byte("text"), "text"},
+		{EncodeStringer, testStringer{Name: "a"}, "stringer:a"},
+		{EncodeText, net.IPv4(10, 0, 0, 1), "10.0.0.1"},
+	}
+	for _, c := range cases {
+		actual, err := c.encoder(c.value)
+		if err != nil || actual != c.expected {
+			t.Errorf("Incorrect encoding of %v; expected %v but was %v (%v)", c.value, c.expected, actual, err)
+		}
+	}
+	if _, err := EncodeDurationString("1s"); err == nil {
+		t.Errorf("Expected failure encoding string as duration")
+	}
+}
+
+func TestFormatterRegisterEncoder(t *testing.T) {
+	t.Parallel()
+	var formatter *Formatter = NewFormatter()
+	formatter.RegisterEncoder(reflect.TypeOf((*time.Duration)(nil)).Elem(), EncodeDurationString)
+	formatter.RegisterEncoder(reflect.TypeOf((*error)(nil)).Elem(), EncodeErrorMessage)
+	formatter.RegisterEncoder(reflect.TypeOf((*[]byte)(nil)).Elem(), EncodeBytesHex)
+	formatter.RegisterEncoder(reflect.TypeOf((*fmt.Stringer)(nil)).Elem(), EncodeStringer)
+	formatter.RegisterEncoder(reflect.TypeOf((**testDomainError)(nil)).Elem(), func(value interface{}) (interface{}, error) {
+		return map[string]string{"domain": value.(*testDomainError).message}, nil
+	})
+	logger, buffer := HelperTestGetLogger("TestFormatterRegisterEncoder", logrus.DebugLevel, formatter)
+	logger.InfoBuilder().
+			SetMessage("TestFormatterRegisterEncoder").
+			AddData("duration", 90 * time.Second).
+			AddData("error", errors.New("failure")).
+			AddData("domainError", &testDomainError{message: "domain failure"}).
+			AddData("bytes", []byte{0xca, 0xfe}).
+			AddData("stringer", testStringer{Name: "a"}).
+			AddData("unregistered", subWidget{Name: "b"}).
+			AddContext("timeout", 5 * time.Millisecond).
+			Log()
+	var event map[string]interface{}
+	if err := json.Unmarshal(buffer.Bytes(), &event); err != nil {
+		t.Fatalf("Unmarshal of actual failed because %v in buffer %s", err, buffer.String())
+	}
+	var data map[string]interface{} = event["data"].(map[string]interface{})
+	var expected map[string]interface{} = map[string]interface{}{
+		"message": "TestFormatterRegisterEncoder",
+		"duration": "1m30s",
+		"error": "failure",
+		"domainError": map[string]interface{}{"domain": "domain failure"},
+		"bytes": "cafe",
+		"stringer": "stringer:a",
+		"unregistered": map[string]interface{}{"Name": "b"},
+	}
+	if !reflect.DeepEqual(expected, data) {
+		t.Errorf("Incorrect encoded data; expected %v but was %v", expected, data)
+	}
+	if v := event["context"].(map[string]interface{})["timeout"]; v != "5ms" {
+		t.Errorf("Incorrect encoded context %v", v)
+	}
+	if formatter.Encoder(reflect.TypeOf((*time.Duration)(nil)).Elem()) == nil {
+		t.Errorf("Expected registered encoder for duration")
+	}
+	formatter.RegisterEncoder(reflect.TypeOf((*time.Duration)(nil)).Elem(), nil)
+	if formatter.Encoder(reflect.TypeOf((*time.Duration)(nil)).Elem()) != nil {
+		t.Errorf("Expected no encoder for duration after removal")
+	}
+}
+
+type testEncodedRequest struct {
+	Timeout time.Duration
+	Body []byte
+	Failures []error
+	Widget *subWidget
+}
+
+func TestFormatterRegisterEncoderNested(t *testing.T) {
+	t.Parallel()
+	var formatter *Formatter = NewFormatter()
+	formatter.RegisterEncoder(reflect.TypeOf((*time.Duration)(nil)).Elem(), EncodeDurationString)
+	formatter.RegisterEncoder(reflect.TypeOf((*error)(nil)).Elem(), EncodeErrorMessage)
+	formatter.RegisterEncoder(reflect.TypeOf((*[]byte)(nil)).Elem(), EncodeBytesHex)
+	formatter.RegisterEncoder(reflect.TypeOf((*subWidget)(nil)).Elem(), func(value interface{}) (interface{}, error) {
+		return "widget:" + value.(subWidget).Name, nil
+	})
+	logger, buffer := HelperTestGetLogger("TestFormatterRegisterEncoderNested", logrus.DebugLevel, formatter)
+	logger.InfoBuilder().
+			SetMessage("TestFormatterRegisterEncoderNested").
+			AddData("request", testEncodedRequest{
+				Timeout: 2 * time.Second,
+				Body: []byte{0xca, 0xfe},
+				Failures: []error{errors.New("first"), nil},
+				Widget: &subWidget{Name: "a"},
+			}).
+			AddData("durations", map[string]interface{}{"connect": time.Millisecond, "read": []time.Duration{time.Minute}}).
+			AddContext("widgets", []subWidget{{Name: "b"}}).
+			Log()
+	var event map[string]map[string]interface{}
+	helperTestUnmarshalBlocks(t, buffer.Bytes(), &event)
+	var expected map[string]string = map[string]string{
+		"request": `{"Body":"cafe","Failures":["first",null],"Timeout":"2s","Widget":"widget:a"}`,
+		"durations": `{"connect":"1ms","read":["1m0s"]}`,
+	}
+	for key, value := range expected {
+		if actual := helperTestMarshalUnescaped(event["data"][key]); actual != value {
+			t.Errorf("Incorrect nested encoding of %s; expected %s but was %s", key, value, actual)
+		}
+	}
+	if actual := helperTestMarshalUnescaped(event["context"]["widgets"]); actual != `["widget:b"]` {
+		t.Errorf("Incorrect nested encoding of context %s", actual)
+	}
+}
+
+func TestFormatterEncoderFailure(t *testing.T) {
+	t.Parallel()
+	var formatter *Formatter = NewFormatter()
+	formatter.RegisterEncoder(reflect.TypeOf((*time.Duration)(nil)).Elem(), EncodeErrorMessage)
+	formatter.RegisterEncoder(reflect.TypeOf((*subWidget)(nil)).Elem(), func(value interface{}) (interface{}, error) {
+		panic("encoder failure")
+	})
+	var formatErrors []*FormatError
+	formatter.SetErrorHandler(func(err error, e *logrus.Entry) {
+		formatErrors = append(formatErrors, err.(*FormatError))
+	})
+	logger, buffer := HelperTestGetLogger("TestFormatterEncoderFailure", logrus.DebugLevel, formatter)
+	logger.InfoBuilder().
+			SetMessage("TestFormatterEncoderFailure").
+			AddData("duration", time.Second).
+			AddContext("widget", subWidget{Name: "a"}).
+			Log()
+	var event struct {
+		Data map[string]interface{}
+		Context map[string]interface{}
+	}
+	if err := json.Unmarshal(buffer.Bytes(), &event); err != nil {
+		t.Fatalf("Unmarshal of actual failed because %v in buffer %s", err, buffer.String())
+	}
+	if v := event.Data["duration"]; v != "<error: gosteno: cannot encode time.Duration as error>" {
+		t.Errorf("Incorrect placeholder for failed encoder %v", v)
+	}
+	if v := event.Context["widget"]; v != "<error: panic: encoder failure>" {
+		t.Errorf("Incorrect placeholder for panicking encoder %v", v)
+	}
+	if v := formatter.ErrorCount(); v != 2 || len(formatErrors) != 2 {
+		t.Errorf("Incorrect number of failures %v", v)
+	}
+}